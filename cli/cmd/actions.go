@@ -0,0 +1,195 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/bennettaur/diffhook/services/diffhook/models/actions"
+	"github.com/bennettaur/diffhook/services/diffhook/state"
+	"github.com/bennettaur/diffhook/services/diffhook/trigger"
+)
+
+// The outcome of one of a triggered watcher's actions
+type actionRun struct {
+	watcher string
+	action  string
+	// started is false for actions that were skipped because the run had already been cancelled
+	started bool
+	err     error
+}
+
+func (r actionRun) String() string {
+	return fmt.Sprintf("%s: %s", r.watcher, r.action)
+}
+
+// Builds the context for a run, which is cancelled on SIGINT or once the timeout (if there is one) has passed
+func runContext(parent context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(parent)
+	if timeout > 0 {
+		var cancelTimeout context.CancelFunc
+		ctx, cancelTimeout = context.WithTimeout(ctx, timeout)
+		cancelRun := cancel
+		cancel = func() {
+			cancelTimeout()
+			cancelRun()
+		}
+	}
+
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	go func() {
+		defer signal.Stop(interrupts)
+		select {
+		case <-interrupts:
+			log.Println("Interrupted, cancelling everything that's still running")
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+// Performs the watcher's actions, skipping any that don't run on the branches
+func performActions(ctx context.Context, tw trigger.TriggeredWatcher, branches *actions.Branches) []actionRun {
+	log.Printf("Triggering watcher: %v", tw.Watcher.Name)
+	var runs []actionRun
+	for _, action := range *tw.Watcher.Actions {
+		if allowed, reason := action.ActionBranchFilters().Allows(branches); !allowed {
+			log.Printf("Skipping action %s, %s", action.ActionName(), reason)
+			continue
+		}
+		run := actionRun{watcher: tw.Watcher.Name, action: action.ActionName()}
+		if ctx.Err() == nil {
+			run.started = true
+			run.err = performAction(ctx, action, tw.ActionTrigger())
+		}
+		runs = append(runs, run)
+	}
+	return runs
+}
+
+// Performs the watcher's actions, unless the state shows they were already performed for the same content in an earlier
+// run on the same branches. Notifications are only recorded once all of the actions succeed, so failures are retried.
+func notifyActions(ctx context.Context, tw trigger.TriggeredWatcher, branches *actions.Branches, notified *state.File) []actionRun {
+	if notified == nil || branches == nil || branches.Source == "" {
+		return performActions(ctx, tw, branches)
+	}
+
+	key := notificationKey(tw, branches)
+	hash := tw.ContentHash()
+	if notified.Notified(key, hash) {
+		log.Printf("Not triggering watcher %s again, it already triggered for the same change on %s", tw.Watcher.Name, branches.Source)
+		return nil
+	}
+
+	runs := performActions(ctx, tw, branches)
+	if succeeded(runs) {
+		notified.Record(key, hash, time.Now())
+	}
+	return runs
+}
+
+// Identifies a watcher's notifications for the branches in the state
+func notificationKey(tw trigger.TriggeredWatcher, branches *actions.Branches) string {
+	return fmt.Sprintf("%s..%s: %s (%s)", branches.Target, branches.Source, tw.Watcher.Name, tw.Watcher.FilePath)
+}
+
+func succeeded(runs []actionRun) bool {
+	for _, run := range runs {
+		if !run.started || run.err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// Runs the action within its timeout
+func performAction(ctx context.Context, action actions.Action, trigger *actions.Trigger) error {
+	return withActionTimeout(ctx, action, func(ctx context.Context) error {
+		return action.Perform(ctx, trigger)
+	})
+}
+
+// Runs perform within the action's timeout. Actions that don't stop when their context is done are abandoned rather
+// than being waited on.
+func withActionTimeout(ctx context.Context, action actions.Action, perform func(ctx context.Context) error) error {
+	timeout, err := action.ActionTimeout()
+	if err != nil {
+		return err
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- perform(ctx)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("action %s didn't finish: %w", action.ActionName(), ctx.Err())
+	}
+}
+
+func actionErrors(runs []actionRun) []error {
+	var errs []error
+	for _, run := range runs {
+		if run.err != nil {
+			errs = append(errs, run.err)
+		}
+	}
+	return errs
+}
+
+// Lists the watchers that were skipped, and who skipped them, so skips can be audited
+func reportSkipped(w io.Writer, skipped []watcherOutcome) {
+	if len(skipped) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "Skipped watchers (%d):\n", len(skipped))
+	for _, o := range skipped {
+		fmt.Fprintf(w, "  %s (%s): %s\n", o.name, o.filePath, o.skip)
+	}
+}
+
+// Lists which actions finished and which didn't when a run is cancelled part way through
+func reportCancelled(w io.Writer, err error, runs []actionRun) {
+	reason := "interrupted"
+	if errors.Is(err, context.DeadlineExceeded) {
+		reason = "timed out"
+	}
+	fmt.Fprintf(w, "The run %s before it finished\n", reason)
+
+	var finished, unfinished []actionRun
+	for _, run := range runs {
+		if run.started && run.err == nil {
+			finished = append(finished, run)
+		} else {
+			unfinished = append(unfinished, run)
+		}
+	}
+
+	fmt.Fprintf(w, "Actions that finished (%d):\n", len(finished))
+	for _, run := range finished {
+		fmt.Fprintf(w, "  %s\n", run)
+	}
+	fmt.Fprintf(w, "Actions that failed or didn't run (%d):\n", len(unfinished))
+	for _, run := range unfinished {
+		if run.started {
+			fmt.Fprintf(w, "  %s (%s)\n", run, run.err)
+		} else {
+			fmt.Fprintf(w, "  %s (not started)\n", run)
+		}
+	}
+	fmt.Fprintln(w, "Watchers in the rest of the diff weren't evaluated")
+}
@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"strings"
+
+	"github.com/bennettaur/diffhook/services/diffhook/models/actions"
+	"github.com/spf13/cobra"
+)
+
+// Environment variables CI providers set with the branch a pull/merge request targets, in the order they're checked
+var targetBranchEnv = []string{
+	"GITHUB_BASE_REF",                     // GitHub Actions
+	"CI_MERGE_REQUEST_TARGET_BRANCH_NAME", // GitLab
+	"BITBUCKET_PR_DESTINATION_BRANCH",     // Bitbucket Pipelines
+	"BUILDKITE_PULL_REQUEST_BASE_BRANCH",  // Buildkite
+}
+
+// Environment variables CI providers set with the branch being built, in the order they're checked
+var sourceBranchEnv = []string{
+	"GITHUB_HEAD_REF",
+	"CI_MERGE_REQUEST_SOURCE_BRANCH_NAME",
+	"CI_COMMIT_BRANCH",
+	"BITBUCKET_BRANCH",
+	"BUILDKITE_BRANCH",
+	"CIRCLE_BRANCH",
+}
+
+// Works out which branches the change is being merged between, for watchers and actions with branch filters. Each
+// branch comes from its flag if it's passed, otherwise from the CI environment, otherwise from git: --git is the target
+// and the checked out branch is the source.
+func detectBranches(ctx context.Context, cmd *cobra.Command) (*actions.Branches, error) {
+	target, err := cmd.Flags().GetString("target-branch")
+	if err != nil {
+		return nil, err
+	}
+	source, err := cmd.Flags().GetString("source-branch")
+	if err != nil {
+		return nil, err
+	}
+	branches := &actions.Branches{Target: target, Source: source}
+
+	if branches.Target == "" {
+		branches.Target = firstEnv(targetBranchEnv)
+	}
+	if branches.Source == "" {
+		branches.Source = firstEnv(sourceBranchEnv)
+	}
+
+	if branches.Target == "" {
+		branches.Target, err = cmd.Flags().GetString("git")
+		if err != nil {
+			return nil, err
+		}
+		branches.Target = strings.TrimPrefix(branches.Target, "origin/")
+	}
+	if branches.Source == "" {
+		branches.Source = gitCurrentBranch(ctx)
+	}
+	return branches, nil
+}
+
+func firstEnv(names []string) string {
+	for _, name := range names {
+		if value := os.Getenv(name); value != "" {
+			return value
+		}
+	}
+	return ""
+}
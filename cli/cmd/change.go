@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"context"
+	"log"
+
+	"github.com/bennettaur/diffhook/services/diffhook/models/actions"
+	"github.com/bennettaur/diffhook/services/diffhook/trigger"
+	"github.com/spf13/cobra"
+)
+
+// Describes the change being evaluated besides its diff: the branches it's between and the pull request it's in
+func loadChange(ctx context.Context, cmd *cobra.Command) (*trigger.Change, error) {
+	branches, err := detectBranches(ctx, cmd)
+	if err != nil {
+		return nil, err
+	}
+	body, err := cmd.Flags().GetString("pr-body")
+	if err != nil {
+		return nil, err
+	}
+	author, err := cmd.Flags().GetString("pr-author")
+	if err != nil {
+		return nil, err
+	}
+
+	change := &trigger.Change{Branches: branches}
+	if body != "" {
+		change.PullRequest = &trigger.PullRequest{Author: author, Body: body}
+	}
+	return change, nil
+}
+
+// Attaches the change, along with the commits in it, to the context. A commit described with --author, --committer and
+// --message takes precedence, otherwise every commit on HEAD that isn't on the --git branch is read from git.
+func withCommits(ctx context.Context, cmd *cobra.Command, change *trigger.Change) (context.Context, error) {
+	commit, err := flagCommit(cmd)
+	if err != nil {
+		return nil, err
+	}
+	if commit != nil {
+		change.Commits = []*actions.Commit{commit}
+		return trigger.WithChange(ctx, change), nil
+	}
+
+	branch, err := cmd.Flags().GetString("git")
+	if err != nil {
+		return nil, err
+	}
+	if len(branch) == 0 {
+		return trigger.WithChange(ctx, change), nil
+	}
+
+	shas, err := gitRevList(ctx, branch)
+	if err != nil {
+		// Only watchers with commit conditions need the commits, so don't stop the rest from being evaluated
+		log.Printf("Warning: can't list the commits since %s: %s", branch, err)
+		return trigger.WithChange(ctx, change), nil
+	}
+	for _, sha := range shas {
+		commit, err := gitCommit(ctx, sha)
+		if err != nil {
+			log.Printf("Warning: can't read commit %s: %s", sha, err)
+			continue
+		}
+		change.Commits = append(change.Commits, commit)
+	}
+	return trigger.WithChange(ctx, change), nil
+}
+
+// The commit described by the flags, or nil if none of them were passed
+func flagCommit(cmd *cobra.Command) (*actions.Commit, error) {
+	author, err := cmd.Flags().GetString("author")
+	if err != nil {
+		return nil, err
+	}
+	committer, err := cmd.Flags().GetString("committer")
+	if err != nil {
+		return nil, err
+	}
+	message, err := cmd.Flags().GetString("message")
+	if err != nil {
+		return nil, err
+	}
+
+	if author == "" && committer == "" && message == "" {
+		return nil, nil
+	}
+	if committer == "" {
+		committer = author
+	}
+	return actions.NewCommit("", author, committer, message), nil
+}
@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/bennettaur/diffhook/services/diffhook/models/actions"
+	"github.com/bennettaur/diffhook/services/diffhook/trigger"
+)
+
+// Evaluates each commit on HEAD that isn't on the branch separately, so every triggered watcher can be traced back to
+// the commit that triggered it. A watcher triggered the same way by several commits is only reported for the first.
+// Watchers' line ranges are written against the branch, so they're carried through each commit before the next one is
+// evaluated.
+func triggerPerCommit(ctx context.Context, index *trigger.Index, branch string, change *trigger.Change) (*trigger.Result, error) {
+	shas, err := gitRevList(ctx, branch)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &trigger.Result{}
+	for _, sha := range shas {
+		commit, err := gitCommit(ctx, sha)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("Evaluating commit %s", commit)
+
+		diffFile, err := gitShow(ctx, sha)
+		if err != nil {
+			return nil, err
+		}
+		diffData := diffFile.Bytes()
+
+		commitChange := *change
+		commitChange.Commits = []*actions.Commit{commit}
+		commitCtx := trigger.WithChange(ctx, &commitChange)
+		commitResult := trigger.TriggerWatchers(commitCtx, index, trigger.NewDiffReader(bytes.NewReader(diffData)))
+		for _, tw := range commitResult.Triggered {
+			tw.Commit = commit
+			result.Triggered = append(result.Triggered, tw)
+		}
+		for _, tw := range commitResult.Skipped {
+			tw.Commit = commit
+			result.Skipped = append(result.Skipped, tw)
+		}
+		for _, err := range commitResult.Errors {
+			result.Errors = append(result.Errors, fmt.Errorf("commit %s: %w", commit, err))
+		}
+
+		next, err := index.AfterDiff(trigger.NewDiffReader(bytes.NewReader(diffData)))
+		if err != nil {
+			// The commit's diff couldn't be parsed, which has already been reported, so carry on with the ranges as
+			// they were
+			continue
+		}
+		index = next
+	}
+	result.Triggered = trigger.Deduplicate(result.Triggered)
+	return result, nil
+}
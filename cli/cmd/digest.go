@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/bennettaur/diffhook/services/diffhook/models/actions"
+	"github.com/bennettaur/diffhook/services/diffhook/state"
+	"github.com/bennettaur/diffhook/services/diffhook/trigger"
+)
+
+// One send in a digest run: either an action batching the triggers of every watcher going to its destination, or an
+// action that's sent on its own
+type digestSend struct {
+	// batch has one trigger for each watcher and file, even if the watcher has several actions going to the destination
+	batch []actions.Batched
+	// watchers and watcherActions are the indexes of the watchers and the actions the send covers, in the same order
+	watchers       []int
+	watcherActions []actions.Action
+	seen           map[string]bool
+}
+
+// Sends the digest for the batch, or performs the action as usual if there's nothing to batch it with
+func (d *digestSend) perform(ctx context.Context) error {
+	first := d.batch[0]
+	batchAction, ok := first.Action.(actions.BatchAction)
+	if !ok || len(d.batch) == 1 {
+		return performAction(ctx, first.Action, first.Trigger)
+	}
+	return withActionTimeout(ctx, batchAction, func(ctx context.Context) error {
+		return batchAction.PerformBatch(ctx, d.batch)
+	})
+}
+
+// Groups the actions of the triggered watchers by type and destination, in the order they were triggered. Each watcher
+// and file is only listed once per digest. Actions that can't be batched each get a send of their own, and actions that
+// don't run on the branches are left out.
+func groupDigests(triggered []trigger.TriggeredWatcher, branches *actions.Branches) []*digestSend {
+	var sends []*digestSend
+	groups := map[string]*digestSend{}
+	for index, tw := range triggered {
+		for _, action := range *tw.Watcher.Actions {
+			if allowed, reason := action.ActionBranchFilters().Allows(branches); !allowed {
+				log.Printf("Skipping action %s, %s", action.ActionName(), reason)
+				continue
+			}
+			batched := actions.Batched{Action: action, Trigger: tw.ActionTrigger()}
+
+			batchAction, ok := action.(actions.BatchAction)
+			if !ok {
+				sends = append(sends, &digestSend{batch: []actions.Batched{batched}, watchers: []int{index}, watcherActions: []actions.Action{action}})
+				continue
+			}
+			key := actions.BatchKey(batchAction)
+			send, ok := groups[key]
+			if !ok {
+				send = &digestSend{seen: map[string]bool{}}
+				groups[key] = send
+				sends = append(sends, send)
+			}
+			watcherKey := tw.Watcher.Name + "\x00" + tw.Watcher.FilePath
+			if !send.seen[watcherKey] {
+				send.seen[watcherKey] = true
+				send.batch = append(send.batch, batched)
+			}
+			send.watchers = append(send.watchers, index)
+			send.watcherActions = append(send.watcherActions, action)
+		}
+	}
+	return sends
+}
+
+// Performs the actions of every triggered watcher, sending one digest per destination for actions that support it
+// instead of one message per watcher. Watchers the state shows were already notified about are left out, and the rest
+// are recorded once all of their actions succeed.
+func performDigest(ctx context.Context, triggered []trigger.TriggeredWatcher, branches *actions.Branches, notified *state.File) []actionRun {
+	useState := notified != nil && branches != nil && branches.Source != ""
+
+	var pending []trigger.TriggeredWatcher
+	for _, tw := range triggered {
+		if useState && notified.Notified(notificationKey(tw, branches), tw.ContentHash()) {
+			log.Printf("Not triggering watcher %s again, it already triggered for the same change on %s", tw.Watcher.Name, branches.Source)
+			continue
+		}
+		log.Printf("Triggering watcher: %v", tw.Watcher.Name)
+		pending = append(pending, tw)
+	}
+
+	var runs []actionRun
+	// Runs for each pending watcher, to only record the watchers whose actions all succeeded
+	watcherRuns := make([][]actionRun, len(pending))
+	for _, send := range groupDigests(pending, branches) {
+		var err error
+		started := ctx.Err() == nil
+		if started {
+			err = send.perform(ctx)
+		}
+		for i, index := range send.watchers {
+			run := actionRun{watcher: pending[index].Watcher.Name, action: send.watcherActions[i].ActionName(), started: started, err: err}
+			runs = append(runs, run)
+			watcherRuns[index] = append(watcherRuns[index], run)
+		}
+	}
+
+	if useState {
+		for i, tw := range pending {
+			if succeeded(watcherRuns[i]) {
+				notified.Record(notificationKey(tw, branches), tw.ContentHash(), time.Now())
+			}
+		}
+	}
+	return runs
+}
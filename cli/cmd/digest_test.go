@@ -0,0 +1,172 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"log"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/bennettaur/diffhook/services/diffhook/models"
+	"github.com/bennettaur/diffhook/services/diffhook/models/actions"
+	"github.com/bennettaur/diffhook/services/diffhook/state"
+	"github.com/bennettaur/diffhook/services/diffhook/trigger"
+	"github.com/sourcegraph/go-diff/diff"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Records what it was asked to do instead of sending anything
+type fakeAction struct {
+	name    string
+	filters actions.BranchFilters
+	fail    bool
+	sent    *[]string
+}
+
+func (a *fakeAction) ActionName() string                         { return a.name }
+func (a *fakeAction) ActionType() actions.ActionType             { return actions.LOG }
+func (a *fakeAction) ActionTimeout() (time.Duration, error)      { return 0, nil }
+func (a *fakeAction) ActionBranchFilters() actions.BranchFilters { return a.filters }
+
+func (a *fakeAction) Perform(ctx context.Context, trigger *actions.Trigger) error {
+	*a.sent = append(*a.sent, a.name+": "+trigger.WatcherName)
+	if a.fail {
+		return errors.New("failed")
+	}
+	return nil
+}
+
+type fakeBatchAction struct {
+	fakeAction
+	destination string
+}
+
+func (a *fakeBatchAction) Destination() string { return a.destination }
+
+func (a *fakeBatchAction) PerformBatch(ctx context.Context, batch []actions.Batched) error {
+	digest := a.destination + ":"
+	for _, b := range batch {
+		digest += " " + b.Trigger.WatcherName
+	}
+	*a.sent = append(*a.sent, digest)
+	if a.fail {
+		return errors.New("failed")
+	}
+	return nil
+}
+
+func TestPerformDigest(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stderr)
+	branches := &actions.Branches{Target: "main", Source: "feature"}
+
+	tests := []struct {
+		name string
+		// watchers builds the triggered watchers, with actions that record what they send in sent
+		watchers      func(sent *[]string) []trigger.TriggeredWatcher
+		wantSent      []string
+		wantNotified  []string
+		wantErrorRuns int
+	}{
+		{
+			name: "watchers to the same destination",
+			watchers: func(sent *[]string) []trigger.TriggeredWatcher {
+				return []trigger.TriggeredWatcher{
+					triggeredWith("One", &fakeBatchAction{fakeAction{name: "slack", sent: sent}, "#frontend"}),
+					triggeredWith("Two", &fakeBatchAction{fakeAction{name: "slack", sent: sent}, "#frontend"}),
+					triggeredWith("Three", &fakeBatchAction{fakeAction{name: "slack", sent: sent}, "#backend"}),
+				}
+			},
+			wantSent:     []string{"#frontend: One Two", "slack: Three"},
+			wantNotified: []string{"One", "Two", "Three"},
+		},
+		{
+			name: "watcher with several actions to the same destination",
+			watchers: func(sent *[]string) []trigger.TriggeredWatcher {
+				return []trigger.TriggeredWatcher{
+					triggeredWith("One", &fakeBatchAction{fakeAction{name: "slack", sent: sent}, "#frontend"}, &fakeBatchAction{fakeAction{name: "slack reminder", sent: sent}, "#frontend"}),
+					triggeredWith("Two", &fakeBatchAction{fakeAction{name: "slack", sent: sent}, "#frontend"}),
+				}
+			},
+			wantSent:     []string{"#frontend: One Two"},
+			wantNotified: []string{"One", "Two"},
+		},
+		{
+			name: "batch and non-batch actions",
+			watchers: func(sent *[]string) []trigger.TriggeredWatcher {
+				return []trigger.TriggeredWatcher{
+					triggeredWith("One", &fakeAction{name: "log", sent: sent}, &fakeBatchAction{fakeAction{name: "slack", sent: sent}, "#frontend"}),
+					triggeredWith("Two", &fakeBatchAction{fakeAction{name: "slack", sent: sent}, "#frontend"}, &fakeAction{name: "log", sent: sent}),
+				}
+			},
+			wantSent:     []string{"log: One", "#frontend: One Two", "log: Two"},
+			wantNotified: []string{"One", "Two"},
+		},
+		{
+			name: "action not on the branch",
+			watchers: func(sent *[]string) []trigger.TriggeredWatcher {
+				mainOnly := actions.BranchFilters{OnlyOn: &actions.BranchFilter{Source: []string{"main"}}}
+				return []trigger.TriggeredWatcher{
+					triggeredWith("One", &fakeBatchAction{fakeAction{name: "slack", sent: sent}, "#frontend"}),
+					triggeredWith("Two", &fakeBatchAction{fakeAction{name: "slack", filters: mainOnly, sent: sent}, "#frontend"}),
+				}
+			},
+			wantSent:     []string{"slack: One"},
+			wantNotified: []string{"One", "Two"},
+		},
+		{
+			name: "partial failure",
+			watchers: func(sent *[]string) []trigger.TriggeredWatcher {
+				return []trigger.TriggeredWatcher{
+					triggeredWith("One", &fakeBatchAction{fakeAction{name: "slack", sent: sent}, "#frontend"}, &fakeAction{name: "log", fail: true, sent: sent}),
+					triggeredWith("Two", &fakeBatchAction{fakeAction{name: "slack", sent: sent}, "#frontend"}),
+					triggeredWith("Three", &fakeBatchAction{fakeAction{name: "slack", fail: true, sent: sent}, "#backend"}),
+				}
+			},
+			wantSent:      []string{"#frontend: One Two", "log: One", "slack: Three"},
+			wantNotified:  []string{"Two"},
+			wantErrorRuns: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			notified, err := state.Load(t.TempDir())
+			require.Nil(t, err, "Error loading state: %s", err)
+
+			var sent []string
+			triggered := tt.watchers(&sent)
+			runs := performDigest(context.Background(), triggered, branches, notified)
+			assert.Equal(t, tt.wantSent, sent)
+			assert.Len(t, actionErrors(runs), tt.wantErrorRuns)
+
+			var gotNotified []string
+			for _, tw := range triggered {
+				if notified.Notified(notificationKey(tw, branches), tw.ContentHash()) {
+					gotNotified = append(gotNotified, tw.Watcher.Name)
+				}
+			}
+			assert.Equal(t, tt.wantNotified, gotNotified)
+
+			// Watchers that were recorded aren't sent again
+			sent = nil
+			performDigest(context.Background(), triggered, branches, notified)
+			for _, name := range tt.wantNotified {
+				for _, s := range sent {
+					assert.NotContains(t, s, name)
+				}
+			}
+		})
+	}
+}
+
+func triggeredWith(name string, watcherActions ...actions.Action) trigger.TriggeredWatcher {
+	actionList := actions.Actions(watcherActions)
+	return trigger.TriggeredWatcher{
+		FileDiff: &diff.FileDiff{OrigName: "a/src/app.ts", NewName: "b/src/app.ts"},
+		Watcher:  models.Watcher{Name: name, FilePath: "a/src/app.ts", Actions: &actionList},
+		Reason:   "Any Change",
+	}
+}
@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/bennettaur/diffhook/services/diffhook/models"
+	"github.com/bennettaur/diffhook/services/diffhook/trigger"
+)
+
+// Exit codes, so CI pipelines can tell why a run failed. 2 is left out as Go uses it for panics.
+const (
+	// diffhook couldn't finish: git failed, the diff couldn't be read, the run was cancelled or timed out, or part of
+	// the diff couldn't be evaluated with --strict
+	exitError = 1
+	// The store couldn't be loaded or isn't valid, or a flag isn't
+	exitConfigError = 3
+	// An action failed with --fail-on-action-error
+	exitActionError = 4
+	// A watcher with at least the --fail-on severity triggered
+	exitTriggered = 5
+)
+
+func exitConfig(err error) {
+	log.Print(err)
+	os.Exit(exitConfigError)
+}
+
+// Reads --fail-on, which is empty if triggered watchers shouldn't fail the run
+func failOnSeverity(failOn string) string {
+	if failOn != "" && !models.ValidSeverity(failOn) {
+		exitConfig(fmt.Errorf("--fail-on must be %s, %s or %s, got %s", models.SEVERITY_INFO, models.SEVERITY_WARNING, models.SEVERITY_ERROR, failOn))
+	}
+	return failOn
+}
+
+// What's kept of a triggered or skipped watcher until the end of the run, for the report and the exit code. The rest,
+// like the file's diff, is let go of once the watcher's actions have run.
+type watcherOutcome struct {
+	name     string
+	filePath string
+	severity string
+	reason   string
+	skip     *trigger.Skip
+}
+
+func outcomeOf(tw trigger.TriggeredWatcher) watcherOutcome {
+	return watcherOutcome{
+		name:     tw.Watcher.Name,
+		filePath: tw.Watcher.FilePath,
+		severity: tw.Watcher.SeverityLevel(),
+		reason:   tw.Reason,
+		skip:     tw.Skip,
+	}
+}
+
+func outcomesOf(triggered []trigger.TriggeredWatcher) []watcherOutcome {
+	var outcomes []watcherOutcome
+	for _, tw := range triggered {
+		outcomes = append(outcomes, outcomeOf(tw))
+	}
+	return outcomes
+}
+
+// Lists the triggered watchers with at least the severity, returning how many there were
+func reportFailing(w io.Writer, triggered []watcherOutcome, severity string) int {
+	if severity == "" {
+		return 0
+	}
+	var failing []watcherOutcome
+	for _, o := range triggered {
+		if models.SeverityAtLeast(o.severity, severity) {
+			failing = append(failing, o)
+		}
+	}
+	if len(failing) == 0 {
+		return 0
+	}
+
+	fmt.Fprintf(w, "Watchers triggered with severity %s or higher (%d):\n", severity, len(failing))
+	for _, o := range failing {
+		fmt.Fprintf(w, "  %s (%s): %s, %s\n", o.name, o.filePath, o.severity, o.reason)
+	}
+	return len(failing)
+}
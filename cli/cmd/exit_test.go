@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/bennettaur/diffhook/services/diffhook/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReportFailing(t *testing.T) {
+	triggered := []watcherOutcome{
+		{name: "Info Watch", filePath: "a/docs/readme.md", severity: models.SEVERITY_INFO, reason: "Any Change"},
+		{name: "Warning Watch", filePath: "a/src/app.go", severity: models.SEVERITY_WARNING, reason: "Watched lines changed"},
+		{name: "Freeze", filePath: "a/src/app.go", severity: models.SEVERITY_ERROR, reason: "Change during freeze Freeze"},
+	}
+
+	tests := []struct {
+		name     string
+		severity string
+		want     int
+	}{
+		{name: "no --fail-on", want: 0},
+		{name: "info", severity: models.SEVERITY_INFO, want: 3},
+		{name: "warning", severity: models.SEVERITY_WARNING, want: 2},
+		{name: "error", severity: models.SEVERITY_ERROR, want: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			assert.Equal(t, tt.want, reportFailing(&out, triggered, tt.severity))
+			if tt.want == 0 {
+				assert.Empty(t, out.String())
+			} else {
+				assert.Contains(t, out.String(), "Freeze (a/src/app.go): error, Change during freeze Freeze")
+			}
+		})
+	}
+}
+
+func TestFailOnSeverity(t *testing.T) {
+	for _, severity := range []string{"", models.SEVERITY_INFO, models.SEVERITY_WARNING, models.SEVERITY_ERROR} {
+		t.Run(severity, func(t *testing.T) {
+			assert.Equal(t, severity, failOnSeverity(severity))
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/bennettaur/diffhook/services/diffhook/models"
+	"github.com/spf13/cobra"
+)
+
+// expiredCmd reports watchers whose active window or snooze is over, so they can be cleaned up
+var expiredCmd = &cobra.Command{
+	Use:   "expired",
+	Short: "List watchers whose active window or snooze has lapsed",
+	Long: `Lists every watcher with an active_until in the past, which will never trigger again and can be deleted, and
+every watcher with a snoozed_until in the past, which can be removed. With --check the command exits with a non-zero
+status if there are any, so CI can catch them.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		check, err := cmd.Flags().GetBool("check")
+		if err != nil {
+			panic(err)
+		}
+
+		store, err := models.GetLocalStore("")
+		if err != nil {
+			panic(err)
+		}
+
+		now := time.Now()
+		expired := 0
+		for _, watcher := range store.Watchers {
+			if reason := watcher.Expired(now); reason != "" {
+				fmt.Printf("%s (%s): %s\n", watcher.Name, watcher.FilePath, reason)
+				expired++
+			}
+		}
+
+		if expired == 0 {
+			fmt.Println("No watchers have lapsed")
+			return
+		}
+		if check {
+			fmt.Printf("%d watchers have lapsed\n", expired)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(expiredCmd)
+	expiredCmd.Flags().Bool("check", false, "Exit with a non-zero status if any watchers have lapsed")
+}
@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+
+	"github.com/bennettaur/diffhook/services/diffhook/trigger"
+	"github.com/spf13/cobra"
+)
+
+// explainCmd evaluates the diff without running any actions and prints how each watcher was evaluated
+var explainCmd = &cobra.Command{
+	Use:   "explain",
+	Short: "Explain why each watcher did or didn't trigger on the diff",
+	Long: `Evaluates the diff the same way diffhook does, without running any actions, and prints every condition checked
+for each watcher: the paths compared, the changed line ranges, the overlaps tested and the first reason the watcher
+was or wasn't triggered. Watchers for files that aren't in the diff are listed too.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		watcher, err := cmd.Flags().GetString("watcher")
+		if err != nil {
+			panic(err)
+		}
+		asJSON, err := cmd.Flags().GetBool("json")
+		if err != nil {
+			panic(err)
+		}
+
+		index, err := trigger.LoadIndex()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		diffFile, err := openDiff(cmd.Context(), cmd)
+		if err != nil {
+			panic(err)
+		}
+		defer closeDiff(diffFile)
+
+		change, err := loadChange(cmd.Context(), cmd)
+		if err != nil {
+			panic(err)
+		}
+		ctx, err := withCommits(cmd.Context(), cmd, change)
+		if err != nil {
+			panic(err)
+		}
+		trace := &trigger.Trace{}
+		ctx = trigger.WithTrace(ctx, trace)
+		result := trigger.TriggerWatchers(ctx, index, trigger.NewDiffReader(diffFile))
+		for _, err := range result.Errors {
+			log.Printf("Warning: %s", err)
+		}
+
+		explanations := trace.Explanations
+		if len(watcher) > 0 {
+			explanations = trace.Filter(watcher)
+			if len(explanations) == 0 {
+				log.Fatalf("No watcher named %s", watcher)
+			}
+		}
+
+		if asJSON {
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			encoder.SetEscapeHTML(false)
+			err = encoder.Encode(explanations)
+			if err != nil {
+				panic(err)
+			}
+			return
+		}
+		trigger.WriteExplanations(os.Stdout, explanations)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(explainCmd)
+	explainCmd.Flags().String("watcher", "", "Only explain the watcher with this name")
+	explainCmd.Flags().Bool("json", false, "Print the explanations as JSON")
+}
@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/bennettaur/diffhook/services/diffhook/models"
+	"github.com/bennettaur/diffhook/services/diffhook/trigger"
+	"github.com/spf13/cobra"
+)
+
+// fingerprintCmd records the content of every watched line range so the lines can be found again if the ranges go stale
+var fingerprintCmd = &cobra.Command{
+	Use:   "fingerprint",
+	Short: "Fingerprint the content of watched line ranges",
+	Long: `Reads each watched file from the working tree and stores a fingerprint of the lines in each of the watcher's
+line ranges (plus a few lines around them). When a diff is evaluated the fingerprints are used to find where the
+watched lines actually are, so watchers keep guarding the right code even if their ranges weren't updated.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		watcherName, err := cmd.Flags().GetString("watcher")
+		if err != nil {
+			panic(err)
+		}
+
+		store, err := models.GetLocalStore("")
+		if err != nil {
+			panic(err)
+		}
+
+		fingerprinted := 0
+		for i := range store.Watchers {
+			watcher := &store.Watchers[i]
+			if len(watcher.Lines) == 0 || (watcherName != "" && watcher.Name != watcherName) {
+				continue
+			}
+
+			err := fingerprintWatcher(store.Dir(), watcher)
+			if err != nil {
+				fmt.Printf("Skipping %s, can't read %s: %s\n", watcher.Name, watcher.FilePath, err)
+				continue
+			}
+			if len(watcher.Fingerprints) > 0 {
+				fingerprinted++
+			}
+		}
+
+		err = store.Save()
+		if err != nil {
+			panic(err)
+		}
+		fmt.Printf("Fingerprinted %d watchers\n", fingerprinted)
+	},
+}
+
+// Fingerprints each of the watcher's line ranges in its file, which is relative to dir (the root of the repository the
+// store is in). Whole file ranges aren't fingerprinted, there's nothing for them to move to.
+func fingerprintWatcher(dir string, watcher *models.Watcher) error {
+	content, err := ioutil.ReadFile(filepath.Join(dir, strings.TrimPrefix(watcher.FilePath, "a/")))
+	if err != nil {
+		return err
+	}
+
+	watcher.Fingerprints = nil
+	for _, lines := range watcher.Lines {
+		if lines == models.FULL_FILE {
+			continue
+		}
+		watcher.Fingerprints = append(watcher.Fingerprints, trigger.NewFingerprint(content, lines))
+	}
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(fingerprintCmd)
+	fingerprintCmd.Flags().String("watcher", "", "Only fingerprint the watcher with this name")
+}
@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bennettaur/diffhook/services/diffhook/models"
+	"github.com/bennettaur/diffhook/services/diffhook/models/actions"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFingerprintWatcher(t *testing.T) {
+	// The store's repository isn't the working directory, so the file can only be found relative to it
+	dir := t.TempDir()
+	require.Nil(t, os.MkdirAll(filepath.Join(dir, "src"), 0755))
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "src", "main.go"), []byte("one\ntwo\nthree\nfour\n"), 0644))
+
+	lines := actions.LineRange{StartLine: 2, EndLine: 3}
+	watcher := models.Watcher{
+		Name:     "Main Watch",
+		FilePath: "a/src/main.go",
+		Lines:    []actions.LineRange{models.FULL_FILE, lines},
+	}
+	require.Nil(t, fingerprintWatcher(dir, &watcher))
+	require.Len(t, watcher.Fingerprints, 1)
+	assert.Equal(t, lines, watcher.Fingerprints[0].Lines)
+	assert.Nil(t, watcher.FingerprintFor(models.FULL_FILE))
+
+	missing := models.Watcher{Name: "Missing Watch", FilePath: "a/src/missing.go", Lines: []actions.LineRange{lines}}
+	assert.NotNil(t, fingerprintWatcher(dir, &missing))
+}
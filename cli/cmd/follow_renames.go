@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/bennettaur/diffhook/services/diffhook/models"
+	"github.com/bennettaur/diffhook/services/diffhook/trigger"
+	"github.com/spf13/cobra"
+)
+
+// followRenamesCmd points watchers of renamed or moved files at the files' new paths
+var followRenamesCmd = &cobra.Command{
+	Use:   "follow-renames",
+	Short: "Update watchers of renamed or moved files to the files' new paths",
+	Long: `Rewrites the file_path of every watcher whose file was renamed or moved in the diff to the file's new path and
+saves the store, so the watchers keep working after the rename. Run it after merging, ex. from a git post-merge hook:
+
+    git diff ORIG_HEAD HEAD | diffhook follow-renames`,
+	Run: func(cmd *cobra.Command, args []string) {
+		dryRun, err := cmd.Flags().GetBool("dry-run")
+		if err != nil {
+			panic(err)
+		}
+
+		diffFile, err := openDiff(cmd.Context(), cmd)
+		if err != nil {
+			panic(err)
+		}
+		defer closeDiff(diffFile)
+
+		store, err := models.GetLocalStore("")
+		if err != nil {
+			panic(err)
+		}
+
+		updates, err := trigger.FollowRenames(store, trigger.NewDiffReader(diffFile))
+		if err != nil {
+			panic(err)
+		}
+
+		if len(updates) == 0 {
+			fmt.Println("No watched files were renamed or moved")
+			return
+		}
+		for _, update := range updates {
+			fmt.Println(update)
+		}
+		if dryRun {
+			return
+		}
+
+		err = store.Save()
+		if err != nil {
+			panic(err)
+		}
+		fmt.Printf("Rewrote the file path of %d watchers\n", len(updates))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(followRenamesCmd)
+	followRenamesCmd.Flags().Bool("dry-run", false, "Print the paths that would be rewritten without saving them")
+}
@@ -2,21 +2,69 @@ package cmd
 
 import (
 	"bytes"
+	"context"
 	"os/exec"
+	"strings"
+
+	"github.com/bennettaur/diffhook/services/diffhook/models/actions"
 )
 
-func gitFetch(branch string) error {
-	gitCmd := exec.Command("git", "fetch", "origin", branch)
+func gitFetch(ctx context.Context, branch string) error {
+	gitCmd := exec.CommandContext(ctx, "git", "fetch", "origin", branch)
 	return gitCmd.Run()
 }
 
-func gitDiff(branch string) (*bytes.Buffer, error) {
+func gitDiff(ctx context.Context, branch string) (*bytes.Buffer, error) {
+	return runGit(ctx, "diff", "origin/"+branch)
+}
+
+// Lists the commits on HEAD that aren't on the branch, oldest first
+func gitRevList(ctx context.Context, branch string) ([]string, error) {
+	stdout, err := runGit(ctx, "rev-list", "--reverse", "origin/"+branch+"..HEAD")
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(stdout.String()), nil
+}
+
+// Generates the diff for a single commit. Merge commits produce a combined diff.
+func gitShow(ctx context.Context, sha string) (*bytes.Buffer, error) {
+	return runGit(ctx, "show", "--format=", sha)
+}
+
+func gitCommit(ctx context.Context, sha string) (*actions.Commit, error) {
+	stdout, err := runGit(ctx, "show", "-s", "--format=%H%x00%an <%ae>%x00%cn <%ce>%x00%B", sha)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := strings.SplitN(stdout.String(), "\x00", 4)
+	if len(fields) < 4 {
+		return &actions.Commit{SHA: strings.TrimSpace(fields[0])}, nil
+	}
+	return actions.NewCommit(fields[0], fields[1], fields[2], fields[3]), nil
+}
+
+// The checked out branch, or "" if HEAD is detached or it isn't a git repository
+func gitCurrentBranch(ctx context.Context) string {
+	stdout, err := runGit(ctx, "rev-parse", "--abbrev-ref", "HEAD")
+	if err != nil {
+		return ""
+	}
+	branch := strings.TrimSpace(stdout.String())
+	if branch == "HEAD" {
+		return ""
+	}
+	return branch
+}
+
+func runGit(ctx context.Context, args ...string) (*bytes.Buffer, error) {
 	var stdout bytes.Buffer
-	gitCmd := exec.Command("git", "diff", "origin/" + branch)
+	gitCmd := exec.CommandContext(ctx, "git", args...)
 	gitCmd.Stdout = &stdout
 	err := gitCmd.Run()
 	if err != nil {
 		return nil, err
 	}
 	return &stdout, nil
-}
\ No newline at end of file
+}
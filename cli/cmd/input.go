@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+// Opens the diff to evaluate: generated with git if --git was passed, otherwise read from --diffFile or stdin
+func openDiff(ctx context.Context, cmd *cobra.Command) (io.ReadCloser, error) {
+	branch, err := cmd.Flags().GetString("git")
+	if err != nil {
+		return nil, err
+	}
+
+	if len(branch) > 0 {
+		err = gitFetch(ctx, branch)
+		if err != nil {
+			return nil, err
+		}
+		diffFile, err := gitDiff(ctx, branch)
+		if err != nil {
+			return nil, err
+		}
+		return ioutil.NopCloser(diffFile), nil
+	}
+
+	if existingDiffFile == os.Stdin.Name() {
+		return os.Stdin, nil
+	}
+	return os.Open(existingDiffFile)
+}
+
+func closeDiff(diffFile io.Closer) {
+	err := diffFile.Close()
+	if err != nil {
+		log.Fatal(err)
+	}
+}
@@ -16,15 +16,16 @@ limitations under the License.
 package cmd
 
 import (
+	"errors"
 	"fmt"
+	"github.com/bennettaur/diffhook/services/diffhook/state"
 	"github.com/bennettaur/diffhook/services/diffhook/trigger"
 	homedir "github.com/mitchellh/go-homedir"
-	"github.com/sourcegraph/go-diff/diff"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
-	"io"
 	"log"
 	"os"
+	"time"
 )
 
 var cfgFile string
@@ -36,57 +37,164 @@ var rootCmd = &cobra.Command{
 	Short: "Analyze diffs and trigger actions based on what's changed",
 	Long: ``,
 	Run: func(cmd *cobra.Command, args []string) {
-		var diffFile io.Reader
 		branch, err := cmd.Flags().GetString("git")
 		if err != nil {
 			panic(err)
 		}
-		if len(branch) > 0 {
-			err = gitFetch(branch)
+		perCommit, err := cmd.Flags().GetBool("per-commit")
+		if err != nil {
+			panic(err)
+		}
+		strict, err := cmd.Flags().GetBool("strict")
+		if err != nil {
+			panic(err)
+		}
+
+		timeout, err := cmd.Flags().GetDuration("timeout")
+		if err != nil {
+			panic(err)
+		}
+		failOn, err := cmd.Flags().GetString("fail-on")
+		if err != nil {
+			panic(err)
+		}
+		failOn = failOnSeverity(failOn)
+		failOnActionError, err := cmd.Flags().GetBool("fail-on-action-error")
+		if err != nil {
+			panic(err)
+		}
+
+		statePath, err := cmd.Flags().GetString("state")
+		if err != nil {
+			panic(err)
+		}
+		digest, err := cmd.Flags().GetBool("digest")
+		if err != nil {
+			panic(err)
+		}
+
+		index, err := trigger.LoadIndex()
+		if err != nil {
+			exitConfig(err)
+		}
+
+		var notified *state.File
+		if statePath != "" {
+			notified, err = state.Load(statePath)
 			if err != nil {
-				panic(err)
+				exitConfig(fmt.Errorf("can't load the state from %s: %w", statePath, err))
 			}
-			diffFile, err = gitDiff(branch)
-			if err != nil {
-				panic(err)
+		}
+
+		ctx, cancel := runContext(cmd.Context(), timeout)
+		defer cancel()
+
+		change, err := loadChange(ctx, cmd)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if notified != nil && (change.Branches == nil || change.Branches.Source == "") {
+			log.Println("Warning: the source branch isn't known, so every notification will be sent even though --state was passed")
+		}
+
+		var runs []actionRun
+		var triggered, skipped []watcherOutcome
+		// Digests can only be sent once the whole diff is evaluated, so the triggered watchers are held on to until then
+		var digested []trigger.TriggeredWatcher
+		var evaluationErrors []error
+		if perCommit {
+			if len(branch) == 0 {
+				exitConfig(errors.New("--per-commit requires --git"))
 			}
-		} else if existingDiffFile == os.Stdin.Name() {
-			f := os.Stdin
-			diffFile = os.Stdin
-			defer func() {
-				err := f.Close()
-				if err != nil {
-					log.Fatal(err)
+			err = gitFetch(ctx, branch)
+			if err == nil {
+				var result *trigger.Result
+				result, err = triggerPerCommit(ctx, index, branch, change)
+				if err == nil {
+					if digest {
+						digested = result.Triggered
+					} else {
+						for _, tw := range result.Triggered {
+							runs = append(runs, notifyActions(ctx, tw, change.Branches, notified)...)
+						}
+					}
+					triggered = outcomesOf(result.Triggered)
+					skipped = outcomesOf(result.Skipped)
+					evaluationErrors = result.Errors
 				}
-			}()
+			}
+			if err != nil && ctx.Err() == nil {
+				log.Fatal(err)
+			}
 		} else {
-			f, err := os.Open(existingDiffFile)
-			if err != nil {
-				panic(err)
+			diffFile, err := openDiff(ctx, cmd)
+			if err != nil && ctx.Err() == nil {
+				log.Fatal(err)
 			}
-			diffFile = f
-			defer func() {
-				err := f.Close()
+			if err == nil {
+				defer closeDiff(diffFile)
+
+				evaluationCtx, err := withCommits(ctx, cmd, change)
 				if err != nil {
 					log.Fatal(err)
 				}
-			}()
+
+				// Run each watcher's actions as soon as it's triggered, rather than waiting for the whole diff, unless
+				// they're being gathered into digests
+				r := trigger.NewDiffReader(diffFile)
+				evaluationErrors = trigger.StreamWatchers(evaluationCtx, index, r, func(tw trigger.TriggeredWatcher) bool {
+					if tw.Skip != nil {
+						skipped = append(skipped, outcomeOf(tw))
+						return true
+					}
+					triggered = append(triggered, outcomeOf(tw))
+					if digest {
+						digested = append(digested, tw)
+					} else {
+						runs = append(runs, notifyActions(ctx, tw, change.Branches, notified)...)
+					}
+					return true
+				})
+			}
 		}
 
-		r := diff.NewMultiFileDiffReader(diffFile)
-		var actionErrors []error
-		for _, tw := range trigger.TriggerWatchers(r) {
-			log.Printf("Triggering watcher: %v", tw.Watcher.Name)
-			for _, action := range *tw.Watcher.Actions {
-				err := action.Perform(tw.Watcher.Name, tw.Watcher.FilePath, tw.Reason, tw.TriggeredLines)
-				if err != nil {
-					actionErrors = append(actionErrors, err)
-				}
+		if digest {
+			runs = append(runs, performDigest(ctx, digested, change.Branches, notified)...)
+		}
+
+		if notified != nil {
+			if err := notified.Save(time.Now()); err != nil {
+				log.Printf("Warning: can't save the state to %s: %s", notified.Path(), err)
+			}
+		}
+
+		if ctx.Err() != nil {
+			reportCancelled(os.Stderr, ctx.Err(), runs)
+			os.Exit(exitError)
+		}
+
+		errs := actionErrors(runs)
+		if len(errs) > 0 {
+			fmt.Printf("Received the following errors:\n %v", errs)
+		}
+
+		reportSkipped(os.Stdout, skipped)
+
+		if len(evaluationErrors) > 0 {
+			fmt.Fprintln(os.Stderr, "Parts of the diff couldn't be evaluated:")
+			for _, err := range evaluationErrors {
+				fmt.Fprintf(os.Stderr, "  %s\n", err)
+			}
+			if strict {
+				os.Exit(exitError)
 			}
 		}
 
-		if len(actionErrors) > 0 {
-			fmt.Printf("Received the following errors:\n %v", actionErrors)
+		if failOnActionError && len(errs) > 0 {
+			os.Exit(exitActionError)
+		}
+		if reportFailing(os.Stderr, triggered, failOn) > 0 {
+			os.Exit(exitTriggered)
 		}
 	},
 }
@@ -109,6 +217,20 @@ func init() {
 	persistentFlags.StringVar(&existingDiffFile, "diffFile", os.Stdin.Name(), "diff file (default is stdin)")
 	persistentFlags.String("git", "", "Run git diff to generate diff")
 	persistentFlags.Lookup("git").NoOptDefVal = "origin/main"
+	persistentFlags.Bool("per-commit", false, "Evaluate each commit since the --git branch separately")
+	persistentFlags.Duration("timeout", 0, "Cancel the run if it takes longer than this (ex. 5m), 0 for no timeout")
+	persistentFlags.String("author", "", "Author of the commit (ex. \"Name <email>\"), for watchers with commit conditions when the diff isn't from --git")
+	persistentFlags.String("committer", "", "Committer of the commit, defaults to --author")
+	persistentFlags.String("message", "", "Message of the commit, including any trailers")
+	persistentFlags.String("target-branch", "", "Branch the change is being merged into, for branch filters (defaults to the CI's pull request target, then --git)")
+	persistentFlags.String("source-branch", "", "Branch the change is on, for branch filters (defaults to the CI's branch, then the checked out branch)")
+	persistentFlags.String("pr-body", "", "Description of the pull request, checked for [skip diffhook] and Diffhook-Skip: lines")
+	persistentFlags.String("pr-author", "", "Author of the pull request, recorded against any watchers its description skips")
+	persistentFlags.String("fail-on", "", "Exit with 5 if a watcher with this severity (info, warning or error) or higher triggers")
+	persistentFlags.Bool("fail-on-action-error", false, "Exit with 4 if any action fails")
+	persistentFlags.String("state", "", "File (or directory) to remember sent notifications in, so re-running on the same branch only notifies about new changes")
+	persistentFlags.Bool("digest", false, "Wait until the whole diff is evaluated, then send one message per destination (ex. Slack channel) listing every watcher that triggered")
+	persistentFlags.Bool("strict", false, "Exit with an error if any part of the diff or any watcher couldn't be evaluated")
 
 }
 
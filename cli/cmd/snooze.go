@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/bennettaur/diffhook/services/diffhook/models"
+	"github.com/spf13/cobra"
+)
+
+// snoozeCmd mutes a watcher for a while without removing it from the store
+var snoozeCmd = &cobra.Command{
+	Use:   "snooze <watcher>",
+	Short: "Mute a watcher for a while",
+	Long: `Sets the watcher's snoozed_until so it isn't evaluated until then, ex. during a planned refactor, and saves the
+store. Durations can be in days (14d) or weeks (2w) as well as anything Go accepts (36h).`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		forValue, err := cmd.Flags().GetString("for")
+		if err != nil {
+			panic(err)
+		}
+		clear, err := cmd.Flags().GetBool("clear")
+		if err != nil {
+			panic(err)
+		}
+
+		var until time.Time
+		if !clear {
+			duration, err := models.ParseSnoozeDuration(forValue)
+			if err != nil {
+				log.Fatalf("Invalid --for: %s", err)
+			}
+			until = time.Now().Add(duration)
+		}
+
+		store, err := models.GetLocalStore("")
+		if err != nil {
+			panic(err)
+		}
+
+		snoozed := 0
+		for i := range store.Watchers {
+			watcher := &store.Watchers[i]
+			if watcher.Name != args[0] {
+				continue
+			}
+			watcher.Snooze(until)
+			snoozed++
+		}
+		if snoozed == 0 {
+			log.Fatalf("No watcher named %s", args[0])
+		}
+
+		err = store.Save()
+		if err != nil {
+			panic(err)
+		}
+		if clear {
+			fmt.Printf("Unsnoozed %s\n", args[0])
+		} else {
+			fmt.Printf("Snoozed %s until %s\n", args[0], until.UTC().Format(time.RFC3339))
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(snoozeCmd)
+	snoozeCmd.Flags().String("for", "14d", "How long to snooze the watcher for, ex. 14d, 2w or 36h")
+	snoozeCmd.Flags().Bool("clear", false, "Unsnooze the watcher instead")
+}
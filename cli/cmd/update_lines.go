@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/bennettaur/diffhook/services/diffhook/models"
+	"github.com/bennettaur/diffhook/services/diffhook/trigger"
+	"github.com/spf13/cobra"
+)
+
+// updateLinesCmd moves the watched line ranges in the store to where those lines are after the diff
+var updateLinesCmd = &cobra.Command{
+	Use:   "update-lines",
+	Short: "Update watched line ranges to match the lines after the diff",
+	Long: `Maps every watcher's line ranges through the diff's hunks to where the lines end up after the change and
+saves the updated ranges back to the store. With --check nothing is saved and the command exits with a non-zero
+status if any range would move, so CI can catch a stale config.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		check, err := cmd.Flags().GetBool("check")
+		if err != nil {
+			panic(err)
+		}
+
+		diffFile, err := openDiff(cmd.Context(), cmd)
+		if err != nil {
+			panic(err)
+		}
+		defer closeDiff(diffFile)
+
+		store, err := models.GetLocalStore("")
+		if err != nil {
+			panic(err)
+		}
+
+		updates, err := trigger.UpdateLines(store, trigger.NewDiffReader(diffFile))
+		if err != nil {
+			panic(err)
+		}
+
+		if len(updates) == 0 {
+			fmt.Println("All watched line ranges are up to date")
+			return
+		}
+		for _, update := range updates {
+			fmt.Println(update)
+		}
+
+		if check {
+			fmt.Printf("%d watched line ranges need updating, run diffhook update-lines\n", len(updates))
+			os.Exit(1)
+		}
+
+		err = store.Save()
+		if err != nil {
+			panic(err)
+		}
+		fmt.Printf("Updated %d watched line ranges\n", len(updates))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(updateLinesCmd)
+	updateLinesCmd.Flags().Bool("check", false, "Exit with a non-zero status instead of saving if any ranges need updating")
+}
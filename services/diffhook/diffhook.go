@@ -1,8 +1,8 @@
 package main
 
 import (
+	"context"
 	"github.com/bennettaur/diffhook/services/diffhook/trigger"
-	"github.com/sourcegraph/go-diff/diff"
 	"log"
 	"os"
 )
@@ -16,6 +16,11 @@ func main() {
 		}
 	}()
 
-	r := diff.NewMultiFileDiffReader(diffFile)
-	trigger.TriggerWatchers(r)
+	index, err := trigger.LoadIndex()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	r := trigger.NewDiffReader(diffFile)
+	trigger.TriggerWatchers(context.Background(), index, r)
 }
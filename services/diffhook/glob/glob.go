@@ -0,0 +1,63 @@
+package glob
+
+import (
+	"path"
+	"strings"
+)
+
+// Match reports whether name matches the shell pattern. It supports everything path.Match does plus "**", which
+// matches any number of path segments (including none). A malformed pattern never matches.
+func Match(pattern, name string) bool {
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+// MatchAny reports whether name matches any of the patterns
+func MatchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if Match(pattern, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Valid reports whether the pattern is well formed, so mistakes can be caught when it's configured rather than it
+// silently never matching
+func Valid(pattern string) bool {
+	for _, segment := range strings.Split(pattern, "/") {
+		if _, err := path.Match(segment, ""); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+func matchSegments(patterns, names []string) bool {
+	for len(patterns) > 0 {
+		if patterns[0] == "**" {
+			// Collapse repeated ** and try every possible number of segments for it to consume
+			for len(patterns) > 0 && patterns[0] == "**" {
+				patterns = patterns[1:]
+			}
+			if len(patterns) == 0 {
+				return true
+			}
+			for i := range names {
+				if matchSegments(patterns, names[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(names) == 0 {
+			return false
+		}
+		matched, err := path.Match(patterns[0], names[0])
+		if err != nil || !matched {
+			return false
+		}
+		patterns, names = patterns[1:], names[1:]
+	}
+	return len(names) == 0
+}
@@ -0,0 +1,50 @@
+package glob
+
+import "testing"
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern string
+		path    string
+		want    bool
+	}{
+		{name: "exact path", pattern: "docs/api.md", path: "docs/api.md", want: true},
+		{name: "different path", pattern: "docs/api.md", path: "docs/other.md", want: false},
+		{name: "single segment wildcard", pattern: "docs/*.md", path: "docs/api.md", want: true},
+		{name: "single segment wildcard doesn't cross directories", pattern: "docs/*.md", path: "docs/v1/api.md", want: false},
+		{name: "double star matches nested directories", pattern: "docs/**/*.md", path: "docs/v1/beta/api.md", want: true},
+		{name: "double star matches no directories", pattern: "docs/**/*.md", path: "docs/api.md", want: true},
+		{name: "trailing double star matches everything below", pattern: "vendor/**", path: "vendor/github.com/x/y.go", want: true},
+		{name: "leading double star matches any depth", pattern: "**/generated.go", path: "a/b/generated.go", want: true},
+		{name: "leading double star needs the suffix", pattern: "**/generated.go", path: "a/b/handwritten.go", want: false},
+		{name: "malformed pattern never matches", pattern: "docs/[", path: "docs/[", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Match(tt.pattern, tt.path); got != tt.want {
+				t.Errorf("Match(%q, %q) = %v, want %v", tt.pattern, tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValid(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    bool
+	}{
+		{pattern: "docs/**/*.md", want: true},
+		{pattern: "vendor/**", want: true},
+		{pattern: "docs/[a-z].md", want: true},
+		{pattern: "docs/[", want: false},
+		{pattern: "docs/\\", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			if got := Valid(tt.pattern); got != tt.want {
+				t.Errorf("Valid(%q) = %v, want %v", tt.pattern, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package interval
+
+import (
+	"sort"
+)
+
+// Interval is an inclusive range of lines, tagged with an ID so callers can tell what it belongs to
+type Interval struct {
+	Start int
+	End   int
+	ID    int
+}
+
+// Tree is a static interval tree. The intervals are kept sorted by start in an array that's treated as a balanced
+// binary tree, with the largest end in each subtree alongside so whole subtrees can be skipped while searching.
+type Tree struct {
+	intervals []Interval
+	maxEnd    []int
+}
+
+// New builds a tree of the intervals. The slice is copied, so the caller is free to reuse it.
+func New(intervals []Interval) *Tree {
+	t := &Tree{
+		intervals: append([]Interval(nil), intervals...),
+		maxEnd:    make([]int, len(intervals)),
+	}
+	sort.SliceStable(t.intervals, func(i, j int) bool {
+		return t.intervals[i].Start < t.intervals[j].Start
+	})
+	t.build(0, len(t.intervals))
+	return t
+}
+
+// Len is the number of intervals in the tree
+func (t *Tree) Len() int {
+	return len(t.intervals)
+}
+
+// Overlapping returns every interval that overlaps [start, end], ordered by start, in O(log n + k)
+func (t *Tree) Overlapping(start, end int) []Interval {
+	var result []Interval
+	t.search(0, len(t.intervals), start, end, &result)
+	return result
+}
+
+func (t *Tree) build(lo, hi int) int {
+	if lo >= hi {
+		return 0
+	}
+	mid := lo + (hi-lo)/2
+	maxEnd := t.intervals[mid].End
+	if lo < mid {
+		maxEnd = max(maxEnd, t.build(lo, mid))
+	}
+	if mid+1 < hi {
+		maxEnd = max(maxEnd, t.build(mid+1, hi))
+	}
+	t.maxEnd[mid] = maxEnd
+	return maxEnd
+}
+
+func (t *Tree) search(lo, hi, start, end int, result *[]Interval) {
+	if lo >= hi {
+		return
+	}
+	mid := lo + (hi-lo)/2
+	if t.maxEnd[mid] < start {
+		// Nothing in this subtree reaches the range
+		return
+	}
+
+	t.search(lo, mid, start, end, result)
+	if t.intervals[mid].Start > end {
+		// Everything to the right starts even later
+		return
+	}
+	if t.intervals[mid].End >= start {
+		*result = append(*result, t.intervals[mid])
+	}
+	t.search(mid+1, hi, start, end, result)
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
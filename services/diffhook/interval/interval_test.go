@@ -0,0 +1,97 @@
+package interval
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTree_Overlapping(t *testing.T) {
+	tree := New([]Interval{
+		{Start: 20, End: 30, ID: 0},
+		{Start: 1, End: 5, ID: 1},
+		{Start: 25, End: 25, ID: 2},
+		{Start: 10, End: 100, ID: 3},
+		{Start: 40, End: 45, ID: 4},
+		{Start: -1, End: -1, ID: 5},
+	})
+
+	tests := []struct {
+		name       string
+		start, end int
+		wantIDs    []int
+	}{
+		{name: "before everything", start: -10, end: -5, wantIDs: nil},
+		{name: "unbounded", start: -1, end: -1, wantIDs: []int{5}},
+		{name: "single line", start: 25, end: 25, wantIDs: []int{3, 0, 2}},
+		{name: "touching the end", start: 5, end: 9, wantIDs: []int{1}},
+		{name: "touching the start", start: 45, end: 50, wantIDs: []int{3, 4}},
+		{name: "inside the widest only", start: 60, end: 70, wantIDs: []int{3}},
+		{name: "after everything", start: 101, end: 200, wantIDs: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ids []int
+			for _, i := range tree.Overlapping(tt.start, tt.end) {
+				ids = append(ids, i.ID)
+			}
+			assert.Equal(t, tt.wantIDs, ids)
+		})
+	}
+}
+
+func TestTree_OverlappingMatchesLinearScan(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	intervals := randomIntervals(r, 500)
+	tree := New(intervals)
+
+	for i := 0; i < 200; i++ {
+		start := r.Intn(10000)
+		end := start + r.Intn(50)
+		assert.ElementsMatch(t, linearOverlapping(intervals, start, end), tree.Overlapping(start, end))
+	}
+}
+
+func randomIntervals(r *rand.Rand, n int) []Interval {
+	intervals := make([]Interval, n)
+	for i := range intervals {
+		start := r.Intn(10000)
+		intervals[i] = Interval{Start: start, End: start + r.Intn(30), ID: i}
+	}
+	return intervals
+}
+
+func linearOverlapping(intervals []Interval, start, end int) []Interval {
+	var result []Interval
+	for _, i := range intervals {
+		if i.Start <= end && start <= i.End {
+			result = append(result, i)
+		}
+	}
+	return result
+}
+
+func benchmarkOverlapping(b *testing.B, n int, overlapping func([]Interval, *Tree, int, int) []Interval) {
+	r := rand.New(rand.NewSource(1))
+	intervals := randomIntervals(r, n)
+	tree := New(intervals)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		start := r.Intn(10000)
+		overlapping(intervals, tree, start, start+10)
+	}
+}
+
+func treeOverlapping(_ []Interval, tree *Tree, start, end int) []Interval {
+	return tree.Overlapping(start, end)
+}
+
+func scanOverlapping(intervals []Interval, _ *Tree, start, end int) []Interval {
+	return linearOverlapping(intervals, start, end)
+}
+
+func BenchmarkTree_Overlapping1000(b *testing.B)  { benchmarkOverlapping(b, 1000, treeOverlapping) }
+func BenchmarkTree_Overlapping10000(b *testing.B) { benchmarkOverlapping(b, 10000, treeOverlapping) }
+func BenchmarkLinearScan1000(b *testing.B)        { benchmarkOverlapping(b, 1000, scanOverlapping) }
+func BenchmarkLinearScan10000(b *testing.B)       { benchmarkOverlapping(b, 10000, scanOverlapping) }
@@ -1,6 +1,7 @@
 package actions
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -8,6 +9,7 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/bsontype"
 	"gopkg.in/yaml.v3"
+	"time"
 )
 
 type Actions []Action
@@ -15,7 +17,12 @@ type Actions []Action
 type Action interface {
 	ActionName() string
 	ActionType() ActionType
-	Perform(watcherName, filePath, reason string, lines *TriggeredLines) error
+	// ActionTimeout is how long the action is given to run, or 0 if it only stops when the run is cancelled
+	ActionTimeout() (time.Duration, error)
+	// ActionBranchFilters limit which branches the action runs on
+	ActionBranchFilters() BranchFilters
+	// Perform runs the action, giving up when ctx is done
+	Perform(ctx context.Context, trigger *Trigger) error
 }
 
 type ActionType string
@@ -28,10 +35,77 @@ const (
 	LOG        ActionType = "log"
 )
 
+// Trigger holds everything an action needs to know about why a watcher was triggered
+type Trigger struct {
+	WatcherName string
+	FilePath    string
+	Reason      string
+	Lines       *TriggeredLines
+	Submodule   *SubmoduleChange
+	Asset       *AssetChange
+	Commit      *Commit
+}
+
 type TriggeredLines struct {
 	DiffLines    LineRange
 	WatchedLines LineRange
 	Hunk         *diff.Hunk
+	// Side is which side of the diff, old or new, the line numbers are on
+	Side string
+}
+
+// Commit identifies the commit that made a change when diffs are evaluated one commit at a time
+type Commit struct {
+	SHA       string
+	Author    string
+	Committer string
+	Subject   string
+	// Message is the full commit message, including the subject
+	Message  string
+	Trailers map[string][]string
+}
+
+func (c *Commit) String() string {
+	sha := c.SHA
+	if len(sha) > 12 {
+		sha = sha[:12]
+	}
+	return fmt.Sprintf("%s (%s): %s", sha, c.Author, c.Subject)
+}
+
+// SubmoduleChange describes a submodule pointer being moved from one commit to another. Commits and Log are only
+// filled in when the submodule is checked out locally
+type SubmoduleChange struct {
+	Path       string
+	OldCommit  string
+	NewCommit  string
+	CheckedOut bool
+	Commits    int
+	Log        []string
+}
+
+// AssetChange describes a Git LFS pointer file being changed to point at a different asset
+type AssetChange struct {
+	Path   string
+	OldOid string
+	NewOid string
+	// Sizes are 0 when the diff doesn't include the size line, ex. diffs without context where only the oid changed
+	OldSize int64
+	NewSize int64
+}
+
+// SizesKnown checks that both sizes were in the diff. LFS doesn't track empty files, so a pointer's size is never 0.
+func (a *AssetChange) SizesKnown() bool {
+	return a.OldSize > 0 && a.NewSize > 0
+}
+
+// GrowthPercent is how much bigger the new asset is than the old one, negative if it shrank, and 0 if the sizes aren't
+// known
+func (a *AssetChange) GrowthPercent() float64 {
+	if !a.SizesKnown() {
+		return 0
+	}
+	return float64(a.NewSize-a.OldSize) / float64(a.OldSize) * 100
 }
 
 type LineRange struct {
@@ -40,8 +114,11 @@ type LineRange struct {
 }
 
 type baseAction struct {
-	Type ActionType `json:"action_type" bson:"action_type" yaml:"type"`
-	Name string     `json:"name" bson:"name" yaml:"name"`
+	Type    ActionType `json:"action_type" bson:"action_type" yaml:"type"`
+	Name    string     `json:"name" bson:"name" yaml:"name"`
+	Timeout string     `json:"timeout,omitempty" bson:"timeout,omitempty" yaml:"timeout,omitempty"`
+
+	BranchFilters `json:",inline" bson:",inline" yaml:",inline"`
 }
 
 func (s LineRange) String() string {
@@ -56,6 +133,17 @@ func (s *baseAction) ActionName() string {
 	return s.Name
 }
 
+func (s *baseAction) ActionTimeout() (time.Duration, error) {
+	if s.Timeout == "" {
+		return 0, nil
+	}
+	return time.ParseDuration(s.Timeout)
+}
+
+func (s *baseAction) ActionBranchFilters() BranchFilters {
+	return s.BranchFilters
+}
+
 func (actions *Actions) UnmarshalBSONValue(t bsontype.Type, data []byte) error {
 	rawData := bson.RawValue{Type: t, Value: data}
 	err := rawData.Unmarshal(&actions)
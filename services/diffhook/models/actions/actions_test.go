@@ -2,11 +2,15 @@ package actions
 
 import (
 	"encoding/json"
+	"fmt"
+	"github.com/slack-go/slack"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"go.mongodb.org/mongo-driver/bson"
 	"gopkg.in/yaml.v3"
+	"strings"
 	"testing"
+	"time"
 )
 
 var marshalTests = []struct {
@@ -143,3 +147,230 @@ func Test_baseAction_ActionType(t *testing.T) {
 		})
 	}
 }
+
+func Test_baseAction_ActionTimeout(t *testing.T) {
+	tests := []struct {
+		name    string
+		timeout string
+		want    time.Duration
+		wantErr bool
+	}{
+		{
+			name: "no timeout",
+			want: 0,
+		},
+		{
+			name:    "duration",
+			timeout: "1m30s",
+			want:    90 * time.Second,
+		},
+		{
+			name:    "invalid duration",
+			timeout: "soon",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			action := &baseAction{Type: LOG, Name: "timeout", Timeout: tt.timeout}
+			got, err := action.ActionTimeout()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ActionTimeout() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ActionTimeout() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewCommit(t *testing.T) {
+	tests := []struct {
+		name         string
+		message      string
+		wantSubject  string
+		wantTrailers map[string][]string
+	}{
+		{
+			name:        "subject only",
+			message:     "Fix: the thing\n",
+			wantSubject: "Fix: the thing",
+		},
+		{
+			name:        "trailers",
+			message:     "Add the thing\n\nMore detail.\n\nSecurity-Review: alice\nSigned-off-by: A <a@example.com>\nSigned-off-by: B\n  <b@example.com>\n",
+			wantSubject: "Add the thing",
+			wantTrailers: map[string][]string{
+				"Security-Review": {"alice"},
+				"Signed-off-by":   {"A <a@example.com>", "B <b@example.com>"},
+			},
+		},
+		{
+			name:        "last paragraph isn't trailers",
+			message:     "Add the thing\n\nSee: the docs for why\nthis was needed.",
+			wantSubject: "Add the thing",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			commit := NewCommit("abc", "A <a@example.com>", "A <a@example.com>", tt.message)
+			assert.Equal(t, tt.wantSubject, commit.Subject)
+			assert.Equal(t, tt.wantTrailers, commit.Trailers)
+		})
+	}
+}
+
+func TestBranchFilters_Allows(t *testing.T) {
+	tests := []struct {
+		name     string
+		filters  BranchFilters
+		branches *Branches
+		want     bool
+	}{
+		{
+			name:     "no filters",
+			branches: &Branches{Target: "main", Source: "feature"},
+			want:     true,
+		},
+		{
+			name:     "only on target",
+			filters:  BranchFilters{OnlyOn: &BranchFilter{Target: []string{"main", "release/*"}}},
+			branches: &Branches{Target: "release/1.2", Source: "feature"},
+			want:     true,
+		},
+		{
+			name:     "not on target",
+			filters:  BranchFilters{OnlyOn: &BranchFilter{Target: []string{"main", "release/*"}}},
+			branches: &Branches{Target: "develop", Source: "feature"},
+		},
+		{
+			name:     "unknown target",
+			filters:  BranchFilters{OnlyOn: &BranchFilter{Target: []string{"main"}}},
+			branches: &Branches{Source: "feature"},
+		},
+		{
+			name:     "except source",
+			filters:  BranchFilters{Except: &BranchFilter{Source: []string{"dependabot/**"}}},
+			branches: &Branches{Target: "main", Source: "dependabot/npm/lodash"},
+		},
+		{
+			name:    "except with unknown branches",
+			filters: BranchFilters{Except: &BranchFilter{Source: []string{"dependabot/**"}}},
+			want:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, reason := tt.filters.Allows(tt.branches)
+			assert.Equal(t, tt.want, got, reason)
+		})
+	}
+}
+
+func TestBatchKey(t *testing.T) {
+	tests := []struct {
+		name  string
+		a     Action
+		b     Action
+		equal bool
+	}{
+		{
+			name:  "same channel",
+			a:     NewSlackAction("one", "#frontend", "One"),
+			b:     NewSlackAction("two", "#frontend", "Two"),
+			equal: true,
+		},
+		{
+			name: "different channels",
+			a:    NewSlackAction("one", "#frontend", "One"),
+			b:    NewSlackAction("two", "#backend", "Two"),
+		},
+		{
+			name: "different types",
+			a:    NewSlackAction("one", "stdout", "One"),
+			b:    NewLogAction("two", "Two"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b := BatchKey(tt.a.(BatchAction)), BatchKey(tt.b.(BatchAction))
+			assert.Equal(t, tt.equal, a == b)
+		})
+	}
+}
+
+func Test_digestMessages(t *testing.T) {
+	batchOf := func(n int, message string) []Batched {
+		var batch []Batched
+		for i := 0; i < n; i++ {
+			batch = append(batch, Batched{
+				Action:  NewSlackAction("slack", "#frontend", message),
+				Trigger: &Trigger{WatcherName: fmt.Sprintf("Watcher %d", i), FilePath: "a/src/app.ts", Reason: "Any Change"},
+			})
+		}
+		return batch
+	}
+
+	tests := []struct {
+		name         string
+		batch        []Batched
+		wantMessages []int
+	}{
+		{name: "fits in one message", batch: batchOf(12, "Check it"), wantMessages: []int{13}},
+		{name: "exactly fills one message", batch: batchOf(49, "Check it"), wantMessages: []int{50}},
+		{name: "split over messages", batch: batchOf(120, "Check it"), wantMessages: []int{50, 50, 23}},
+		{name: "long messages", batch: batchOf(2, strings.Repeat("é", 5000)), wantMessages: []int{3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			messages := digestMessages(tt.batch)
+			var sizes []int
+			for _, blocks := range messages {
+				sizes = append(sizes, len(blocks))
+				for _, block := range blocks[1:] {
+					text := block.(*slack.SectionBlock).Text.Text
+					assert.LessOrEqual(t, len([]rune(text)), slackMaxSectionText)
+				}
+			}
+			assert.Equal(t, tt.wantMessages, sizes)
+		})
+	}
+}
+
+func Test_digestMessagesTitle(t *testing.T) {
+	trigger := &Trigger{WatcherName: "Watcher", FilePath: "a/src/app.ts", Reason: "Any Change"}
+	other := &Trigger{WatcherName: "Other Watcher", FilePath: "a/src/app.ts", Reason: "Any Change"}
+	batch := []Batched{
+		{Action: NewSlackAction("slack", "#frontend", "Check it"), Trigger: trigger},
+		{Action: NewSlackAction("slack reminder", "#frontend", "Check it again"), Trigger: trigger},
+		{Action: NewSlackAction("slack", "#frontend", "Check it"), Trigger: other},
+	}
+
+	messages := digestMessages(batch)
+	require.Len(t, messages, 1)
+	assert.Equal(t, "diffhook: 2 watchers triggered", messages[0][0].(*slack.HeaderBlock).Text.Text)
+}
+
+func Test_formatAssetChange(t *testing.T) {
+	tests := []struct {
+		name  string
+		asset *AssetChange
+		want  string
+	}{
+		{
+			name:  "sizes known",
+			asset: &AssetChange{Path: "assets/logo.png", OldOid: "sha256:old", NewOid: "sha256:new", OldSize: 1000, NewSize: 1300},
+			want:  "Asset Replaced: `assets/logo.png` changed from 1000 bytes to 1300 bytes (+30.0%)\n\nOld: `sha256:old`\nNew: `sha256:new`",
+		},
+		{
+			name:  "sizes unknown",
+			asset: &AssetChange{Path: "assets/logo.png", OldOid: "sha256:old", NewOid: "sha256:new"},
+			want:  "Asset Replaced: `assets/logo.png` changed\n\nOld: `sha256:old`\nNew: `sha256:new`",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, formatAssetChange("Asset Replaced", tt.asset))
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package actions
+
+import (
+	"context"
+	"fmt"
+)
+
+// BatchAction is implemented by actions that can send one digest for several triggers going to the same destination,
+// instead of a message each
+type BatchAction interface {
+	Action
+	// Destination is where the action sends to, ex. a Slack channel. Actions of the same type and destination are
+	// batched together.
+	Destination() string
+	// PerformBatch sends one digest covering every trigger in the batch, instead of running the action for each
+	PerformBatch(ctx context.Context, batch []Batched) error
+}
+
+// Batched is one of the triggers in a batch, along with the action it triggered
+type Batched struct {
+	Action  Action
+	Trigger *Trigger
+}
+
+// BatchKey identifies the actions that can be batched together
+func BatchKey(action BatchAction) string {
+	return fmt.Sprintf("%s\x00%s", action.ActionType(), action.Destination())
+}
+
+// Summarises why the watcher was triggered in a line, for listing in a digest
+func summarise(trigger *Trigger) string {
+	summary := fmt.Sprintf("%s (%s): %s", trigger.WatcherName, trigger.FilePath, trigger.Reason)
+	if trigger.Lines != nil {
+		summary = fmt.Sprintf("%s, lines %s (%s side)", summary, trigger.Lines.WatchedLines, trigger.Lines.Side)
+	}
+	if trigger.Commit != nil {
+		summary = fmt.Sprintf("%s, in commit %s", summary, trigger.Commit)
+	}
+	return summary
+}
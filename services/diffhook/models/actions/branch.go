@@ -0,0 +1,82 @@
+package actions
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bennettaur/diffhook/services/diffhook/glob"
+)
+
+// Branches are the branches a change is being merged between. Either can be empty if it isn't known.
+type Branches struct {
+	// Target is the branch being merged into, ex. main
+	Target string
+	Source string
+}
+
+// BranchFilter is a list of globs for the target branches and a list for the source branches
+type BranchFilter struct {
+	Target []string `json:"target,omitempty" bson:"target,omitempty" yaml:"target,omitempty"`
+	Source []string `json:"source,omitempty" bson:"source,omitempty" yaml:"source,omitempty"`
+}
+
+// BranchFilters limit which branches a watcher triggers on or an action runs on, like only/except rules in CI. An
+// unknown branch never matches, so only_on filters for it aren't met and except filters for it don't apply.
+type BranchFilters struct {
+	OnlyOn *BranchFilter `json:"only_on,omitempty" bson:"only_on,omitempty" yaml:"only_on,omitempty"`
+	Except *BranchFilter `json:"except,omitempty" bson:"except,omitempty" yaml:"except,omitempty"`
+}
+
+func (f BranchFilters) IsZero() bool {
+	return f.OnlyOn == nil && f.Except == nil
+}
+
+func (f BranchFilters) Validate() []error {
+	var validationErrors []error
+	for _, filter := range []*BranchFilter{f.OnlyOn, f.Except} {
+		if filter == nil {
+			continue
+		}
+		for _, pattern := range append(filter.Target, filter.Source...) {
+			if !glob.Valid(pattern) {
+				validationErrors = append(validationErrors, fmt.Errorf("branch filter %q isn't a valid glob", pattern))
+			}
+		}
+	}
+	return validationErrors
+}
+
+// Allows checks the branches against the filters, returning the first filter they don't pass if they're not allowed
+func (f BranchFilters) Allows(branches *Branches) (bool, string) {
+	if branches == nil {
+		branches = &Branches{}
+	}
+	if f.OnlyOn != nil {
+		if len(f.OnlyOn.Target) > 0 && !matchBranch(f.OnlyOn.Target, branches.Target) {
+			return false, fmt.Sprintf("target branch %s isn't one of %s", describeBranch(branches.Target), strings.Join(f.OnlyOn.Target, ", "))
+		}
+		if len(f.OnlyOn.Source) > 0 && !matchBranch(f.OnlyOn.Source, branches.Source) {
+			return false, fmt.Sprintf("source branch %s isn't one of %s", describeBranch(branches.Source), strings.Join(f.OnlyOn.Source, ", "))
+		}
+	}
+	if f.Except != nil {
+		if matchBranch(f.Except.Target, branches.Target) {
+			return false, fmt.Sprintf("target branch %s is excluded", branches.Target)
+		}
+		if matchBranch(f.Except.Source, branches.Source) {
+			return false, fmt.Sprintf("source branch %s is excluded", branches.Source)
+		}
+	}
+	return true, ""
+}
+
+func matchBranch(patterns []string, branch string) bool {
+	return branch != "" && glob.MatchAny(patterns, branch)
+}
+
+func describeBranch(branch string) string {
+	if branch == "" {
+		return "(unknown)"
+	}
+	return branch
+}
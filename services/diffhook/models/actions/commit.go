@@ -0,0 +1,59 @@
+package actions
+
+import (
+	"regexp"
+	"strings"
+)
+
+var trailerPattern = regexp.MustCompile(`^([A-Za-z0-9][A-Za-z0-9-]*):\s*(.*)$`)
+
+// NewCommit fills in the commit's subject and trailers from its message
+func NewCommit(sha, author, committer, message string) *Commit {
+	message = strings.TrimSpace(message)
+	return &Commit{
+		SHA:       sha,
+		Author:    author,
+		Committer: committer,
+		Subject:   strings.SplitN(message, "\n", 2)[0],
+		Message:   message,
+		Trailers:  parseTrailers(message),
+	}
+}
+
+// HasTrailer checks if the commit has the trailer. Trailer keys are case insensitive, like in git.
+func (c *Commit) HasTrailer(key string) bool {
+	for k := range c.Trailers {
+		if strings.EqualFold(k, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// Trailers are "Key: value" lines in the last paragraph of a message, ex. "Signed-off-by: A <a@example.com>". Lines
+// starting with whitespace continue the previous trailer's value.
+func parseTrailers(message string) map[string][]string {
+	paragraphs := strings.Split(strings.ReplaceAll(message, "\r\n", "\n"), "\n\n")
+	if len(paragraphs) < 2 {
+		// The subject is never a trailer
+		return nil
+	}
+
+	trailers := make(map[string][]string)
+	var lastKey string
+	for _, line := range strings.Split(strings.TrimSpace(paragraphs[len(paragraphs)-1]), "\n") {
+		if lastKey != "" && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) {
+			values := trailers[lastKey]
+			values[len(values)-1] += " " + strings.TrimSpace(line)
+			continue
+		}
+		match := trailerPattern.FindStringSubmatch(line)
+		if match == nil {
+			// Not a trailer block, just a paragraph that happens to be last
+			return nil
+		}
+		lastKey = match[1]
+		trailers[lastKey] = append(trailers[lastKey], strings.TrimSpace(match[2]))
+	}
+	return trailers
+}
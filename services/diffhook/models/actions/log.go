@@ -1,6 +1,7 @@
 package actions
 
 import (
+	"context"
 	"fmt"
 )
 
@@ -19,7 +20,37 @@ func NewLogAction(name, message string) Action {
 	}
 }
 
-func (s *Log) Perform(watcherName, filePath, reason string, lines *TriggeredLines) error {
+func (s *Log) Perform(ctx context.Context, trigger *Trigger) error {
 	fmt.Printf("I logged message %s\n", s.Message)
+	if trigger.Lines != nil {
+		fmt.Printf("Changed lines %s (%s side) in %s\n", trigger.Lines.WatchedLines, trigger.Lines.Side, trigger.FilePath)
+	}
+	if trigger.Commit != nil {
+		fmt.Printf("Changed in commit %s\n", trigger.Commit)
+	}
+	if trigger.Submodule != nil {
+		fmt.Printf("Submodule %s moved from %s to %s\n", trigger.Submodule.Path, trigger.Submodule.OldCommit, trigger.Submodule.NewCommit)
+	}
+	if trigger.Asset != nil && trigger.Asset.SizesKnown() {
+		fmt.Printf("Asset %s replaced, %d bytes (%s) -> %d bytes (%s)\n", trigger.Asset.Path, trigger.Asset.OldSize, trigger.Asset.OldOid, trigger.Asset.NewSize, trigger.Asset.NewOid)
+	} else if trigger.Asset != nil {
+		fmt.Printf("Asset %s replaced, %s -> %s\n", trigger.Asset.Path, trigger.Asset.OldOid, trigger.Asset.NewOid)
+	}
+	return nil
+}
+
+func (s *Log) Destination() string {
+	return "stdout"
+}
+
+func (s *Log) PerformBatch(ctx context.Context, batch []Batched) error {
+	fmt.Printf("I logged a digest of %d triggered watchers\n", len(batch))
+	for _, b := range batch {
+		message := ""
+		if l, ok := b.Action.(*Log); ok {
+			message = l.Message
+		}
+		fmt.Printf("  %s: %s\n", summarise(b.Trigger), message)
+	}
 	return nil
 }
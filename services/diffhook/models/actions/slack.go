@@ -1,12 +1,20 @@
 package actions
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/slack-go/slack"
 	"github.com/spf13/viper"
 	"log"
+	"strings"
+)
+
+// Limits Slack puts on a message, which it rejects outright rather than truncating
+const (
+	slackMaxBlocks      = 50
+	slackMaxSectionText = 3000
 )
 
 type Slack struct {
@@ -26,8 +34,8 @@ func NewSlackAction(name, channel, message string) Action {
 	}
 }
 
-func (s *Slack) Perform(watcherName, filePath, reason string, lines *TriggeredLines) error {
-	channelId, err := findChannelId(s.Channel)
+func (s *Slack) Perform(ctx context.Context, trigger *Trigger) error {
+	channelId, err := findChannelId(ctx, s.Channel)
 	if err != nil {
 		return err
 	}
@@ -39,7 +47,7 @@ func (s *Slack) Perform(watcherName, filePath, reason string, lines *TriggeredLi
 
 	header := &slack.TextBlockObject{
 		Type: slack.PlainTextType,
-		Text: fmt.Sprintf("%s: %s", watcherName, s.Name),
+		Text: fmt.Sprintf("%s: %s", trigger.WatcherName, s.Name),
 	}
 
 	msgSection := &slack.TextBlockObject{
@@ -48,10 +56,24 @@ func (s *Slack) Perform(watcherName, filePath, reason string, lines *TriggeredLi
 	}
 
 	var changeTrigger string
-	if lines == nil {
-		changeTrigger = reason
+	if trigger.Submodule != nil {
+		changeTrigger = formatSubmoduleChange(trigger.Reason, trigger.Submodule)
+	} else if trigger.Asset != nil {
+		changeTrigger = formatAssetChange(trigger.Reason, trigger.Asset)
+	} else if trigger.Lines == nil {
+		changeTrigger = trigger.Reason
 	} else {
-		changeTrigger = fmt.Sprintf("Changed lines in %s:\n\n```\n%s\n```", filePath, lines.Hunk.Body)
+		changeTrigger = fmt.Sprintf(
+			"Changed lines %s (%s side) in %s:\n\n```\n%s\n```",
+			trigger.Lines.WatchedLines,
+			trigger.Lines.Side,
+			trigger.FilePath,
+			trigger.Lines.Hunk.Body,
+		)
+	}
+
+	if trigger.Commit != nil {
+		changeTrigger = fmt.Sprintf("%s\n\nChanged in commit %s", changeTrigger, trigger.Commit)
 	}
 
 	codeSection := &slack.TextBlockObject{
@@ -69,7 +91,7 @@ func (s *Slack) Perform(watcherName, filePath, reason string, lines *TriggeredLi
 	blocks, _ := json.Marshal(postBlocks)
 	log.Printf("Marshaled blocks:\n%s", blocks)
 
-	_, _, err = api.PostMessage(channelId, slack.MsgOptionBlocks(postBlocks...))
+	_, _, err = api.PostMessageContext(ctx, channelId, slack.MsgOptionBlocks(postBlocks...))
 
 	if err != nil {
 		return err
@@ -79,7 +101,107 @@ func (s *Slack) Perform(watcherName, filePath, reason string, lines *TriggeredLi
 	return nil
 }
 
-func findChannelId(channelName string) (string, error) {
+func (s *Slack) Destination() string {
+	return s.Channel
+}
+
+// PerformBatch posts a digest to the channel, listing each watcher, file and reason along with the watcher's message.
+// Digests too big for one Slack message are split over as many messages as it takes.
+func (s *Slack) PerformBatch(ctx context.Context, batch []Batched) error {
+	channelId, err := findChannelId(ctx, s.Channel)
+	if err != nil {
+		return err
+	}
+
+	api, err := getSlackClient()
+	if err != nil {
+		return err
+	}
+
+	messages := digestMessages(batch)
+	for i, postBlocks := range messages {
+		_, _, err = api.PostMessageContext(ctx, channelId, slack.MsgOptionBlocks(postBlocks...))
+		if err != nil {
+			return fmt.Errorf("sent %d of %d digest messages: %w", i, len(messages), err)
+		}
+	}
+
+	fmt.Printf("I slacked a digest of %d triggered watchers to channel %s:%s\n", len(batch), s.Channel, channelId)
+	return nil
+}
+
+// Builds the blocks of each message in the digest, with a header and as many triggers as fit under Slack's limits
+func digestMessages(batch []Batched) [][]slack.Block {
+	perMessage := slackMaxBlocks - 1
+	parts := (len(batch) + perMessage - 1) / perMessage
+	watchers := map[string]bool{}
+	for _, b := range batch {
+		watchers[b.Trigger.WatcherName] = true
+	}
+
+	var messages [][]slack.Block
+	for part := 0; part < parts; part++ {
+		title := fmt.Sprintf("diffhook: %d watchers triggered", len(watchers))
+		if parts > 1 {
+			title = fmt.Sprintf("%s (%d of %d)", title, part+1, parts)
+		}
+		postBlocks := []slack.Block{slack.NewHeaderBlock(&slack.TextBlockObject{Type: slack.PlainTextType, Text: title})}
+
+		end := (part + 1) * perMessage
+		if end > len(batch) {
+			end = len(batch)
+		}
+		for _, b := range batch[part*perMessage : end] {
+			text := fmt.Sprintf("*%s*", summarise(b.Trigger))
+			if action, ok := b.Action.(*Slack); ok && action.Message != "" {
+				text = fmt.Sprintf("%s\n%s", text, action.Message)
+			}
+			section := &slack.TextBlockObject{Type: slack.MarkdownType, Text: truncate(text, slackMaxSectionText)}
+			postBlocks = append(postBlocks, slack.NewSectionBlock(section, nil, nil))
+		}
+		messages = append(messages, postBlocks)
+	}
+	return messages
+}
+
+// Cuts text down to at most max characters, marking where it was cut
+func truncate(text string, max int) string {
+	runes := []rune(text)
+	if len(runes) <= max {
+		return text
+	}
+	return string(runes[:max-1]) + "…"
+}
+
+func formatSubmoduleChange(reason string, submodule *SubmoduleChange) string {
+	text := fmt.Sprintf("%s: `%s` moved from `%s` to `%s`", reason, submodule.Path, submodule.OldCommit, submodule.NewCommit)
+	if !submodule.CheckedOut {
+		return text
+	}
+	text = fmt.Sprintf("%s (%d commits)", text, submodule.Commits)
+	if len(submodule.Log) > 0 {
+		text = fmt.Sprintf("%s\n\n```\n%s\n```", text, strings.Join(submodule.Log, "\n"))
+	}
+	return text
+}
+
+func formatAssetChange(reason string, asset *AssetChange) string {
+	if !asset.SizesKnown() {
+		return fmt.Sprintf("%s: `%s` changed\n\nOld: `%s`\nNew: `%s`", reason, asset.Path, asset.OldOid, asset.NewOid)
+	}
+	return fmt.Sprintf(
+		"%s: `%s` changed from %d bytes to %d bytes (%+.1f%%)\n\nOld: `%s`\nNew: `%s`",
+		reason,
+		asset.Path,
+		asset.OldSize,
+		asset.NewSize,
+		asset.GrowthPercent(),
+		asset.OldOid,
+		asset.NewOid,
+	)
+}
+
+func findChannelId(ctx context.Context, channelName string) (string, error) {
 	api, err := getSlackClient()
 	if err != nil {
 		return "", err
@@ -91,7 +213,7 @@ func findChannelId(channelName string) (string, error) {
 		Types:           []string{"public_channel", "private_channel"},
 	}
 	for {
-		channels, nextCursor, err := api.GetConversations(params)
+		channels, nextCursor, err := api.GetConversationsContext(ctx, params)
 		if err != nil {
 			return "", err
 		}
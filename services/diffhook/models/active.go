@@ -0,0 +1,119 @@
+package models
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Dates without a time are in UTC. Used as the end of a window, a date includes the whole day.
+const dateLayout = "2006-01-02"
+
+// Parses a time in RFC 3339 format or a date, ex. 2021-06-30
+func parseWatcherTime(value string, endOfDay bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(dateLayout, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q isn't a date (ex. 2021-06-30) or RFC 3339 time", value)
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
+
+// Active checks if the watcher should be evaluated at the time, returning why not if it shouldn't be. Times that don't
+// parse are ignored, Validate reports them.
+func (w *Watcher) Active(now time.Time) (bool, string) {
+	if w.ActiveFrom != "" {
+		if from, err := parseWatcherTime(w.ActiveFrom, false); err == nil && now.Before(from) {
+			return false, fmt.Sprintf("not active until %s", w.ActiveFrom)
+		}
+	}
+	if w.ActiveUntil != "" {
+		if until, err := parseWatcherTime(w.ActiveUntil, true); err == nil && !now.Before(until) {
+			return false, fmt.Sprintf("stopped being active after %s", w.ActiveUntil)
+		}
+	}
+	if w.SnoozedUntil != "" {
+		if until, err := parseWatcherTime(w.SnoozedUntil, true); err == nil && now.Before(until) {
+			return false, fmt.Sprintf("snoozed until %s", w.SnoozedUntil)
+		}
+	}
+	return true, ""
+}
+
+// Expired describes what about the watcher has lapsed at the time, or returns "" if nothing has: an active_until in
+// the past means the watcher can be deleted, and a snoozed_until in the past can be removed
+func (w *Watcher) Expired(now time.Time) string {
+	if w.ActiveUntil != "" {
+		if until, err := parseWatcherTime(w.ActiveUntil, true); err == nil && !now.Before(until) {
+			return fmt.Sprintf("stopped being active after %s", w.ActiveUntil)
+		}
+	}
+	if w.SnoozedUntil != "" {
+		if until, err := parseWatcherTime(w.SnoozedUntil, true); err == nil && !now.Before(until) {
+			return fmt.Sprintf("snooze ended after %s", w.SnoozedUntil)
+		}
+	}
+	return ""
+}
+
+// ParseSnoozeDuration parses how long to snooze a watcher for, which can be in days or weeks (ex. 14d or 2w) as well as
+// anything time.ParseDuration accepts. It has to be in the future.
+func ParseSnoozeDuration(value string) (time.Duration, error) {
+	duration, err := parseLongDuration(value)
+	if err != nil {
+		return 0, err
+	}
+	if duration <= 0 {
+		return 0, fmt.Errorf("%q has to be longer than 0", value)
+	}
+	return duration, nil
+}
+
+func parseLongDuration(value string) (time.Duration, error) {
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if !strings.HasSuffix(value, suffix) {
+			continue
+		}
+		count, err := strconv.Atoi(strings.TrimSuffix(value, suffix))
+		if err != nil {
+			return 0, fmt.Errorf("%q isn't a number of days or weeks", value)
+		}
+		return time.Duration(count) * unit, nil
+	}
+	return time.ParseDuration(value)
+}
+
+// Snooze mutes the watcher until the time, or unmutes it if the time is zero
+func (w *Watcher) Snooze(until time.Time) {
+	if until.IsZero() {
+		w.SnoozedUntil = ""
+		return
+	}
+	w.SnoozedUntil = until.UTC().Truncate(time.Second).Format(time.RFC3339)
+}
+
+func (w *Watcher) validateActive() []error {
+	var validationErrors []error
+	for _, field := range []struct {
+		name  string
+		value string
+	}{
+		{"active_from", w.ActiveFrom},
+		{"active_until", w.ActiveUntil},
+		{"snoozed_until", w.SnoozedUntil},
+	} {
+		if field.value == "" {
+			continue
+		}
+		if _, err := parseWatcherTime(field.value, false); err != nil {
+			validationErrors = append(validationErrors, fmt.Errorf("%s %s", field.name, err))
+		}
+	}
+	return validationErrors
+}
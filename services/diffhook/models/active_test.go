@@ -0,0 +1,73 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSnoozeDuration(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{value: "14d", want: 14 * 24 * time.Hour},
+		{value: "2w", want: 14 * 24 * time.Hour},
+		{value: "36h", want: 36 * time.Hour},
+		{value: "0d", wantErr: true},
+		{value: "-3d", wantErr: true},
+		{value: "-1h", wantErr: true},
+		{value: "d", wantErr: true},
+		{value: "soon", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseSnoozeDuration(tt.value)
+			assert.Equal(t, tt.wantErr, err != nil, "ParseSnoozeDuration() error = %v", err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestWatcher_Snooze(t *testing.T) {
+	now := time.Date(2021, 6, 15, 12, 0, 0, 0, time.UTC)
+	watcher := Watcher{Name: "Timed Watch", FilePath: "a/test/testdiff.txt"}
+
+	toronto, err := time.LoadLocation("America/Toronto")
+	require.Nil(t, err, "Error loading timezone: %s", err)
+	watcher.Snooze(time.Date(2021, 6, 29, 8, 30, 15, 500, toronto))
+	assert.Equal(t, "2021-06-29T12:30:15Z", watcher.SnoozedUntil)
+	active, _ := watcher.Active(now)
+	assert.False(t, active)
+	assert.Nil(t, watcher.Validate())
+
+	watcher.Snooze(time.Time{})
+	assert.Equal(t, "", watcher.SnoozedUntil)
+	active, _ = watcher.Active(now)
+	assert.True(t, active)
+}
+
+func TestWatcher_Expired(t *testing.T) {
+	now := time.Date(2021, 6, 15, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		watcher Watcher
+		want    string
+	}{
+		{name: "no window"},
+		{name: "still active", watcher: Watcher{ActiveUntil: "2021-06-15"}},
+		{name: "active window over", watcher: Watcher{ActiveUntil: "2021-06-14"}, want: "stopped being active after 2021-06-14"},
+		{name: "still snoozed", watcher: Watcher{SnoozedUntil: "2021-06-15T13:00:00Z"}},
+		{name: "snooze over", watcher: Watcher{SnoozedUntil: "2021-06-15T11:00:00Z"}, want: "snooze ended after 2021-06-15T11:00:00Z"},
+		{name: "not active yet", watcher: Watcher{ActiveFrom: "2021-07-01"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.watcher.Expired(now))
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/bennettaur/diffhook/services/diffhook/glob"
+	"github.com/bennettaur/diffhook/services/diffhook/models/actions"
+)
+
+// CommitConditions limit a watcher to changes made in certain commits. People are matched with globs against their
+// name, their email or "Name <email>", and messages with regular expressions. When a diff covers several commits, the
+// watcher triggers if any one of them meets every condition.
+type CommitConditions struct {
+	Authors          []string `json:"author,omitempty" bson:"author,omitempty" yaml:"author,omitempty"`
+	ExceptAuthors    []string `json:"except_author,omitempty" bson:"except_author,omitempty" yaml:"except_author,omitempty"`
+	Committers       []string `json:"committer,omitempty" bson:"committer,omitempty" yaml:"committer,omitempty"`
+	ExceptCommitters []string `json:"except_committer,omitempty" bson:"except_committer,omitempty" yaml:"except_committer,omitempty"`
+	Message          string   `json:"message,omitempty" bson:"message,omitempty" yaml:"message,omitempty"`
+	ExceptMessage    string   `json:"except_message,omitempty" bson:"except_message,omitempty" yaml:"except_message,omitempty"`
+	// Trailers the commit has to have, and trailers the commit has to be missing, ex. Security-Review
+	Trailers        []string `json:"trailers,omitempty" bson:"trailers,omitempty" yaml:"trailers,omitempty"`
+	MissingTrailers []string `json:"missing_trailers,omitempty" bson:"missing_trailers,omitempty" yaml:"missing_trailers,omitempty"`
+
+	// Message and ExceptMessage, compiled the first time they're needed
+	message       *regexp.Regexp
+	exceptMessage *regexp.Regexp
+}
+
+func (c *CommitConditions) Validate() []error {
+	var validationErrors []error
+	for _, patterns := range [][]string{c.Authors, c.ExceptAuthors, c.Committers, c.ExceptCommitters} {
+		for _, pattern := range patterns {
+			if !glob.Valid(pattern) {
+				validationErrors = append(validationErrors, fmt.Errorf("commit condition %q isn't a valid glob", pattern))
+			}
+		}
+	}
+	return append(validationErrors, c.compile()...)
+}
+
+// Compiles the message expressions that haven't been compiled yet
+func (c *CommitConditions) compile() []error {
+	var compileErrors []error
+	for _, expr := range []struct {
+		source   string
+		compiled **regexp.Regexp
+	}{{c.Message, &c.message}, {c.ExceptMessage, &c.exceptMessage}} {
+		if expr.source == "" || *expr.compiled != nil {
+			continue
+		}
+		compiled, err := regexp.Compile(expr.source)
+		if err != nil {
+			compileErrors = append(compileErrors, fmt.Errorf("commit condition %q isn't a valid regular expression: %s", expr.source, err))
+			continue
+		}
+		*expr.compiled = compiled
+	}
+	return compileErrors
+}
+
+// Match checks whether the commit meets every condition, returning the first one it doesn't meet if not. An error is
+// returned if the message expressions don't compile.
+func (c *CommitConditions) Match(commit *actions.Commit) (bool, string, error) {
+	if compileErrors := c.compile(); len(compileErrors) > 0 {
+		return false, "", compileErrors[0]
+	}
+	if len(c.Authors) > 0 && !matchPerson(c.Authors, commit.Author) {
+		return false, fmt.Sprintf("author %s isn't one of %s", commit.Author, strings.Join(c.Authors, ", ")), nil
+	}
+	if matchPerson(c.ExceptAuthors, commit.Author) {
+		return false, fmt.Sprintf("author %s is excluded", commit.Author), nil
+	}
+	if len(c.Committers) > 0 && !matchPerson(c.Committers, commit.Committer) {
+		return false, fmt.Sprintf("committer %s isn't one of %s", commit.Committer, strings.Join(c.Committers, ", ")), nil
+	}
+	if matchPerson(c.ExceptCommitters, commit.Committer) {
+		return false, fmt.Sprintf("committer %s is excluded", commit.Committer), nil
+	}
+	if c.message != nil && !c.message.MatchString(commit.Message) {
+		return false, fmt.Sprintf("message doesn't match %s", c.Message), nil
+	}
+	if c.exceptMessage != nil && c.exceptMessage.MatchString(commit.Message) {
+		return false, fmt.Sprintf("message matches %s", c.ExceptMessage), nil
+	}
+	for _, trailer := range c.Trailers {
+		if !commit.HasTrailer(trailer) {
+			return false, fmt.Sprintf("missing the %s trailer", trailer), nil
+		}
+	}
+	for _, trailer := range c.MissingTrailers {
+		if commit.HasTrailer(trailer) {
+			return false, fmt.Sprintf("has the %s trailer", trailer), nil
+		}
+	}
+	return true, "", nil
+}
+
+// Matches "Name <email>" as a whole, or just the name or email
+func matchPerson(patterns []string, person string) bool {
+	candidates := []string{person}
+	if open := strings.LastIndex(person, " <"); open >= 0 && strings.HasSuffix(person, ">") {
+		candidates = append(candidates, person[:open], person[open+2:len(person)-1])
+	}
+	for _, candidate := range candidates {
+		if glob.MatchAny(patterns, candidate) {
+			return true
+		}
+	}
+	return false
+}
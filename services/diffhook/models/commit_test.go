@@ -0,0 +1,56 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/bennettaur/diffhook/services/diffhook/models/actions"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommitConditions_Match(t *testing.T) {
+	commit := &actions.Commit{Author: "Alice <alice@example.com>", Message: "PROJ-12 Fix the login form"}
+	tests := []struct {
+		name        string
+		conditions  CommitConditions
+		validate    bool
+		wantMatched bool
+		wantReason  string
+		wantErr     bool
+	}{
+		{
+			name:        "message matches",
+			conditions:  CommitConditions{Message: `^[A-Z]+-\d+ `},
+			wantMatched: true,
+		},
+		{
+			name:        "validated message matches",
+			conditions:  CommitConditions{Message: `^[A-Z]+-\d+ `},
+			validate:    true,
+			wantMatched: true,
+		},
+		{
+			name:       "except message matches",
+			conditions: CommitConditions{ExceptMessage: `PROJ-\d+`},
+			wantReason: `message matches PROJ-\d+`,
+		},
+		{
+			name:       "invalid message",
+			conditions: CommitConditions{Authors: []string{"Bob"}, ExceptMessage: "PROJ-("},
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.validate {
+				assert.Empty(t, tt.conditions.Validate())
+			}
+			// Checked twice so the second match uses the compiled expressions
+			for i := 0; i < 2; i++ {
+				matched, reason, err := tt.conditions.Match(commit)
+				assert.Equal(t, tt.wantErr, err != nil, "Match() error = %v", err)
+				assert.Equal(t, tt.wantMatched, matched)
+				assert.Equal(t, tt.wantReason, reason)
+			}
+		})
+	}
+}
@@ -0,0 +1,15 @@
+package models
+
+import "github.com/bennettaur/diffhook/services/diffhook/models/actions"
+
+// Fingerprint identifies the content of one of a watcher's line ranges so the lines can still be found after they've
+// moved. Lines is the range the fingerprint was taken for, which is how it's matched up with the watcher's Lines.
+type Fingerprint struct {
+	Lines actions.LineRange `json:"lines" bson:"lines" yaml:"lines"`
+	// Hash of the whitespace normalised lines in the range
+	Hash string `json:"hash" bson:"hash" yaml:"hash"`
+	// ContextBefore is how many of the LineHashes come before the range
+	ContextBefore int `json:"context_before" bson:"context_before" yaml:"context_before"`
+	// LineHashes are short hashes of each line in the range and a few lines around it, used for fuzzy matching
+	LineHashes []string `json:"line_hashes" bson:"line_hashes" yaml:"line_hashes,flow"`
+}
@@ -0,0 +1,117 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bennettaur/diffhook/services/diffhook/glob"
+	"github.com/bennettaur/diffhook/services/diffhook/models/actions"
+)
+
+// Layouts accepted for the start and end of a freeze, besides RFC 3339 times which carry their own offset
+var freezeLayouts = []string{"2006-01-02T15:04", "2006-01-02 15:04", dateLayout}
+
+// Freeze is a window of time when changes to some paths aren't allowed, ex. around a release. Any change to one of
+// the paths during the window triggers the freeze's actions.
+type Freeze struct {
+	Name string `json:"name" bson:"name" yaml:"name"`
+	// Start and End are dates or times in the freeze's timezone. An end date includes the whole day.
+	Start    string `json:"start" bson:"start" yaml:"start"`
+	End      string `json:"end" bson:"end" yaml:"end"`
+	Timezone string `json:"timezone,omitempty" bson:"timezone,omitempty" yaml:"timezone,omitempty"`
+	// Paths (or globs) that are frozen, and paths under them that can still be changed
+	Paths   []string         `json:"paths" bson:"paths" yaml:"paths"`
+	Except  []string         `json:"except,omitempty" bson:"except,omitempty" yaml:"except,omitempty"`
+	Actions *actions.Actions `json:"actions" bson:"actions" yaml:"actions"`
+	// Severity of changes during the freeze, error by default
+	Severity string `json:"severity,omitempty" bson:"severity,omitempty" yaml:"severity,omitempty"`
+}
+
+// SeverityLevel returns how important a change during the freeze is, defaulting to error
+func (f *Freeze) SeverityLevel() string {
+	if f.Severity == "" {
+		return SEVERITY_ERROR
+	}
+	return f.Severity
+}
+
+// Window returns when the freeze starts and ends
+func (f *Freeze) Window() (time.Time, time.Time, error) {
+	location := time.UTC
+	if f.Timezone != "" {
+		var err error
+		location, err = time.LoadLocation(f.Timezone)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("unknown timezone %s", f.Timezone)
+		}
+	}
+
+	start, err := parseFreezeTime(f.Start, location, false)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("start %s", err)
+	}
+	end, err := parseFreezeTime(f.End, location, true)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("end %s", err)
+	}
+	return start, end, nil
+}
+
+func parseFreezeTime(value string, location *time.Location, endOfDay bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	for _, layout := range freezeLayouts {
+		t, err := time.ParseInLocation(layout, value, location)
+		if err != nil {
+			continue
+		}
+		if endOfDay && layout == dateLayout {
+			t = t.AddDate(0, 0, 1)
+		}
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("%q isn't a date (ex. 2021-12-20), a time (ex. 2021-12-20T17:00) or RFC 3339 time", value)
+}
+
+// Active checks if the time is inside the freeze's window. Freezes with an invalid window are never active, Validate
+// reports them.
+func (f *Freeze) Active(now time.Time) bool {
+	start, end, err := f.Window()
+	return err == nil && !now.Before(start) && now.Before(end)
+}
+
+// Covers checks if the path is frozen
+func (f *Freeze) Covers(path string) bool {
+	return glob.MatchAny(f.Paths, path) && !glob.MatchAny(f.Except, path)
+}
+
+func (f *Freeze) Validate() error {
+	var validationErrors []string
+	if f.Name == "" {
+		validationErrors = append(validationErrors, "missing name")
+	}
+	if start, end, err := f.Window(); err != nil {
+		validationErrors = append(validationErrors, err.Error())
+	} else if !end.After(start) {
+		validationErrors = append(validationErrors, "end isn't after start")
+	}
+	if f.Severity != "" && !ValidSeverity(f.Severity) {
+		validationErrors = append(validationErrors, fmt.Sprintf("severity must be %s, %s or %s, got %s", SEVERITY_INFO, SEVERITY_WARNING, SEVERITY_ERROR, f.Severity))
+	}
+	if len(f.Paths) == 0 {
+		validationErrors = append(validationErrors, "missing paths")
+	}
+	for _, pattern := range append(f.Paths, f.Except...) {
+		if !glob.Valid(pattern) {
+			validationErrors = append(validationErrors, fmt.Sprintf("%q isn't a valid glob", pattern))
+		}
+	}
+
+	if len(validationErrors) == 0 {
+		return nil
+	}
+	return errors.New(strings.Join(validationErrors, ", "))
+}
@@ -0,0 +1,87 @@
+package models
+
+import (
+	"sort"
+
+	"github.com/bennettaur/diffhook/services/diffhook/interval"
+	"github.com/bennettaur/diffhook/services/diffhook/models/actions"
+)
+
+// Index looks up the watchers of a file by path, and the watched line ranges that overlap a change with an interval
+// tree per file and side, so evaluating a diff doesn't scan every watcher for every file
+type Index struct {
+	files map[string]*FileIndex
+}
+
+// FileIndex holds the watchers of a single file, in the order they're configured
+type FileIndex struct {
+	Watchers []Watcher
+	sides    map[string]*interval.Tree
+}
+
+// WatchedRange is a watched line range that overlapped a change, along with the position of its watcher in the file's
+// Watchers
+type WatchedRange struct {
+	Watcher int
+	Lines   actions.LineRange
+}
+
+// NewIndex indexes the watchers. Each watcher's line ranges are copied and sorted, so the watchers passed in aren't
+// modified.
+func NewIndex(watchers []Watcher) *Index {
+	index := &Index{files: make(map[string]*FileIndex)}
+	ranges := make(map[string]map[string][]interval.Interval)
+
+	for _, watcher := range watchers {
+		file, ok := index.files[watcher.FilePath]
+		if !ok {
+			file = &FileIndex{sides: make(map[string]*interval.Tree)}
+			index.files[watcher.FilePath] = file
+			ranges[watcher.FilePath] = make(map[string][]interval.Interval)
+		}
+
+		watcher.Lines = append([]actions.LineRange(nil), watcher.Lines...)
+		sort.Slice(watcher.Lines, func(i, j int) bool {
+			return watcher.Lines[i].StartLine < watcher.Lines[j].StartLine
+		})
+
+		id := len(file.Watchers)
+		file.Watchers = append(file.Watchers, watcher)
+		for _, lines := range watcher.Lines {
+			ranges[watcher.FilePath][watcher.Side()] = append(
+				ranges[watcher.FilePath][watcher.Side()],
+				interval.Interval{Start: lines.StartLine, End: lines.EndLine, ID: id},
+			)
+		}
+	}
+
+	for filePath, sides := range ranges {
+		for side, intervals := range sides {
+			index.files[filePath].sides[side] = interval.New(intervals)
+		}
+	}
+	return index
+}
+
+// File returns the index of the watchers of the file, or nil if nothing watches it
+func (i *Index) File(filePath string) *FileIndex {
+	return i.files[filePath]
+}
+
+// Overlapping returns the ranges, watched on the given side of the diff, that overlap the lines. Ranges are ordered by
+// their start line.
+func (f *FileIndex) Overlapping(side string, lines actions.LineRange) []WatchedRange {
+	tree, ok := f.sides[side]
+	if !ok {
+		return nil
+	}
+
+	var result []WatchedRange
+	for _, i := range tree.Overlapping(lines.StartLine, lines.EndLine) {
+		result = append(result, WatchedRange{
+			Watcher: i.ID,
+			Lines:   actions.LineRange{StartLine: i.Start, EndLine: i.End},
+		})
+	}
+	return result
+}
@@ -0,0 +1,25 @@
+package models
+
+// How important a triggered watcher is, from least to most
+const (
+	SEVERITY_INFO    = "info"
+	SEVERITY_WARNING = "warning"
+	SEVERITY_ERROR   = "error"
+)
+
+var severityRanks = map[string]int{
+	SEVERITY_INFO:    1,
+	SEVERITY_WARNING: 2,
+	SEVERITY_ERROR:   3,
+}
+
+// ValidSeverity checks if the severity is one of info, warning or error
+func ValidSeverity(severity string) bool {
+	_, ok := severityRanks[severity]
+	return ok
+}
+
+// SeverityAtLeast checks if the severity is the same as or more severe than the minimum
+func SeverityAtLeast(severity, minimum string) bool {
+	return severityRanks[severity] >= severityRanks[minimum]
+}
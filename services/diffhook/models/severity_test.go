@@ -0,0 +1,71 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSeverityAtLeast(t *testing.T) {
+	tests := []struct {
+		severity string
+		minimum  string
+		want     bool
+	}{
+		{SEVERITY_INFO, SEVERITY_INFO, true},
+		{SEVERITY_INFO, SEVERITY_WARNING, false},
+		{SEVERITY_INFO, SEVERITY_ERROR, false},
+		{SEVERITY_WARNING, SEVERITY_INFO, true},
+		{SEVERITY_WARNING, SEVERITY_WARNING, true},
+		{SEVERITY_WARNING, SEVERITY_ERROR, false},
+		{SEVERITY_ERROR, SEVERITY_INFO, true},
+		{SEVERITY_ERROR, SEVERITY_WARNING, true},
+		{SEVERITY_ERROR, SEVERITY_ERROR, true},
+		{"critical", SEVERITY_INFO, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.severity+" at least "+tt.minimum, func(t *testing.T) {
+			assert.Equal(t, tt.want, SeverityAtLeast(tt.severity, tt.minimum))
+		})
+	}
+}
+
+func TestValidSeverity(t *testing.T) {
+	tests := []struct {
+		severity string
+		want     bool
+	}{
+		{SEVERITY_INFO, true},
+		{SEVERITY_WARNING, true},
+		{SEVERITY_ERROR, true},
+		{"", false},
+		{"Error", false},
+		{"critical", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.severity, func(t *testing.T) {
+			assert.Equal(t, tt.want, ValidSeverity(tt.severity))
+		})
+	}
+}
+
+func TestWatcher_Severity(t *testing.T) {
+	tests := []struct {
+		name      string
+		severity  string
+		wantLevel string
+		wantErr   bool
+	}{
+		{name: "default", wantLevel: SEVERITY_WARNING},
+		{name: "set", severity: SEVERITY_ERROR, wantLevel: SEVERITY_ERROR},
+		{name: "invalid", severity: "critical", wantLevel: "critical", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &Watcher{Name: "Watch", FilePath: "a/test/testdiff.txt", Severity: tt.severity}
+			assert.Equal(t, tt.wantLevel, w.SeverityLevel())
+			err := w.Validate()
+			assert.Equal(t, tt.wantErr, err != nil, "Validate() = %v", err)
+		})
+	}
+}
@@ -1,8 +1,13 @@
 package models
 
 import (
+	"bytes"
+	"fmt"
+	"github.com/bennettaur/diffhook/services/diffhook/glob"
 	"gopkg.in/yaml.v3"
 	"io/ioutil"
+	"path/filepath"
+	"strings"
 )
 
 const DefaultFileStore = ".diffhook.yml"
@@ -13,17 +18,39 @@ func SetLocalStore(filePath string) {
 	configuredStore = filePath
 }
 
+// ConfiguredLocalStore is the path of the store GetLocalStore loads by default
+func ConfiguredLocalStore() string {
+	return configuredStore
+}
+
 type Store interface {
 	Find ()
 }
 
 type LocalStore struct {
-	filePath string
-	Watchers []Watcher `json:"watchers"`
+	filePath         string
+	Exclude          []string  `json:"exclude,omitempty" yaml:"exclude,omitempty"`
+	UseGitattributes bool      `json:"use_gitattributes,omitempty" yaml:"use_gitattributes,omitempty"`
+	Watchers         []Watcher `json:"watchers"`
+	Freezes          []Freeze  `json:"freezes,omitempty" yaml:"freezes,omitempty"`
+}
+
+// Path is the file the store was loaded from
+func (l *LocalStore) Path() string {
+	return l.filePath
 }
 
+// Dir is the directory the store was loaded from, which is the root of the repository it watches
+func (l *LocalStore) Dir() string {
+	return filepath.Dir(l.filePath)
+}
+
+// GetLocalStore loads the store from the file, or the configured store if the path is empty
 func GetLocalStore(filePath string) (*LocalStore, error) {
-	l := &LocalStore{filePath: configuredStore}
+	if filePath == "" {
+		filePath = configuredStore
+	}
+	l := &LocalStore{filePath: filePath}
 	data, err := ioutil.ReadFile(l.filePath)
 	if err != nil {
 		return nil, err
@@ -36,12 +63,40 @@ func GetLocalStore(filePath string) (*LocalStore, error) {
 	return l, nil
 }
 
+// Validate checks every watcher in the store, returning a single error that lists all of the problems found
+func (l *LocalStore) Validate() error {
+	var problems []string
+	for _, pattern := range l.Exclude {
+		if !glob.Valid(pattern) {
+			problems = append(problems, fmt.Sprintf("exclude %q isn't a valid glob", pattern))
+		}
+	}
+	for i := range l.Watchers {
+		if err := l.Watchers[i].Validate(); err != nil {
+			problems = append(problems, fmt.Sprintf("watcher %d (%s): %s", i+1, l.Watchers[i].Name, err))
+		}
+	}
+	for i := range l.Freezes {
+		if err := l.Freezes[i].Validate(); err != nil {
+			problems = append(problems, fmt.Sprintf("freeze %d (%s): %s", i+1, l.Freezes[i].Name, err))
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid watchers:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
 func (l *LocalStore) Save() error {
-	data, err := yaml.Marshal(l)
+	var data bytes.Buffer
+	encoder := yaml.NewEncoder(&data)
+	encoder.SetIndent(2)
+	err := encoder.Encode(l)
 	if err != nil {
 		return err
 	}
 
-	err = ioutil.WriteFile(l.filePath, data, 0644)
+	err = ioutil.WriteFile(l.filePath, data.Bytes(), 0644)
 	return err
 }
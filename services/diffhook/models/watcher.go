@@ -2,7 +2,10 @@ package models
 
 import (
 	"errors"
+	"fmt"
+	"strings"
 
+	"github.com/bennettaur/diffhook/services/diffhook/glob"
 	"github.com/bennettaur/diffhook/services/diffhook/models/actions"
 	"github.com/kamva/mgm/v3"
 	"go.mongodb.org/mongo-driver/bson"
@@ -12,21 +15,43 @@ const UNBOUNDED = -1
 
 var FULL_FILE = actions.LineRange{StartLine: UNBOUNDED, EndLine: UNBOUNDED}
 
+// Which side of the diff a watcher's line numbers refer to
+const (
+	OLD_SIDE = "old"
+	NEW_SIDE = "new"
+)
+
 // TODO: Watcher for new file added in a directory
 type Watcher struct {
 	// DefaultModel add _id,created_at and updated_at fields to the Model
-	mgm.DefaultModel `bson:",inline"`
-	Name             string              `json:"name" bson:"name" yaml:"name"`
-	Host             string              `json:"host" bson:"host" yaml:"host"`
-	FilePath         string              `json:"file_path" bson:"file_path" yaml:"file_path"`
-	Lines            []actions.LineRange `json:"lines,omitempty" bson:"lines,omitempty" yaml:"lines,omitempty"`
-	TriggerAny       bool                `json:"trigger_any" bson:"trigger_any" yaml:"trigger_any"`
-	TriggerAnyLine   bool                `json:"trigger_any_line" bson:"trigger_any_line" yaml:"trigger_any_line"`
-	TriggerOnRename  bool                `json:"trigger_on_rename" bson:"trigger_on_rename" yaml:"trigger_on_rename"`
-	TriggerOnMove    bool                `json:"trigger_on_move" bson:"trigger_on_move" yaml:"trigger_on_move"`
-	TriggerOnDelete  bool                `json:"trigger_on_delete" bson:"trigger_on_delete" yaml:"trigger_on_delete"`
-	TriggerOnMode    bool                `json:"trigger_on_mode" bson:"trigger_on_mode" yaml:"trigger_on_mode"`
-	Actions          *actions.Actions    `json:"actions" bson:"actions" yaml:"actions"`
+	mgm.DefaultModel     `bson:",inline" yaml:"-"`
+	Name                 string              `json:"name" bson:"name" yaml:"name"`
+	Host                 string              `json:"host" bson:"host" yaml:"host"`
+	Tags                 []string            `json:"tags,omitempty" bson:"tags,omitempty" yaml:"tags,omitempty"`
+	Severity             string              `json:"severity,omitempty" bson:"severity,omitempty" yaml:"severity,omitempty"`
+	ActiveFrom           string              `json:"active_from,omitempty" bson:"active_from,omitempty" yaml:"active_from,omitempty"`
+	ActiveUntil          string              `json:"active_until,omitempty" bson:"active_until,omitempty" yaml:"active_until,omitempty"`
+	SnoozedUntil         string              `json:"snoozed_until,omitempty" bson:"snoozed_until,omitempty" yaml:"snoozed_until,omitempty"`
+	FilePath             string              `json:"file_path" bson:"file_path" yaml:"file_path"`
+	Lines                []actions.LineRange `json:"lines,omitempty" bson:"lines,omitempty" yaml:"lines,omitempty"`
+	LineSide             string              `json:"line_side,omitempty" bson:"line_side,omitempty" yaml:"line_side,omitempty"`
+	IgnoreFormatting     bool                `json:"ignore_formatting" bson:"ignore_formatting" yaml:"ignore_formatting,omitempty"`
+	Fingerprints         []Fingerprint       `json:"fingerprints,omitempty" bson:"fingerprints,omitempty" yaml:"fingerprints,omitempty"`
+	TriggerAny           bool                `json:"trigger_any" bson:"trigger_any" yaml:"trigger_any,omitempty"`
+	TriggerAnyLine       bool                `json:"trigger_any_line" bson:"trigger_any_line" yaml:"trigger_any_line,omitempty"`
+	TriggerOnRename      bool                `json:"trigger_on_rename" bson:"trigger_on_rename" yaml:"trigger_on_rename,omitempty"`
+	TriggerOnMove        bool                `json:"trigger_on_move" bson:"trigger_on_move" yaml:"trigger_on_move,omitempty"`
+	TriggerOnDelete      bool                `json:"trigger_on_delete" bson:"trigger_on_delete" yaml:"trigger_on_delete,omitempty"`
+	TriggerOnMode        bool                `json:"trigger_on_mode" bson:"trigger_on_mode" yaml:"trigger_on_mode,omitempty"`
+	TriggerOnSubmodule   bool                `json:"trigger_on_submodule" bson:"trigger_on_submodule" yaml:"trigger_on_submodule,omitempty"`
+	TriggerOnAssetChange bool                `json:"trigger_on_asset_change" bson:"trigger_on_asset_change" yaml:"trigger_on_asset_change,omitempty"`
+	AssetGrowthPercent   float64             `json:"asset_growth_percent,omitempty" bson:"asset_growth_percent,omitempty" yaml:"asset_growth_percent,omitempty"`
+	RequiresChangeIn     []string            `json:"requires_change_in,omitempty" bson:"requires_change_in,omitempty" yaml:"requires_change_in,omitempty"`
+	Commit               *CommitConditions   `json:"commit,omitempty" bson:"commit,omitempty" yaml:"commit,omitempty"`
+	Actions              *actions.Actions    `json:"actions" bson:"actions" yaml:"actions"`
+
+	// only_on and except limit which branches the watcher triggers on
+	actions.BranchFilters `json:",inline" bson:",inline" yaml:",inline"`
 }
 
 func NewWatcher(name, host, filePath string, lines []actions.LineRange) *Watcher {
@@ -42,8 +67,30 @@ func (w *Watcher) AddAction(a actions.Action) {
 	*w.Actions = append(*w.Actions, a)
 }
 
-func FindWatchersForFile(filePath string) ([]Watcher, error) {
-	return findWatcherForFileLocal(filePath)
+// FingerprintFor returns the fingerprint taken for the line range, if there is one
+func (w *Watcher) FingerprintFor(lines actions.LineRange) *Fingerprint {
+	for i := range w.Fingerprints {
+		if w.Fingerprints[i].Lines == lines {
+			return &w.Fingerprints[i]
+		}
+	}
+	return nil
+}
+
+// Side returns which side of the diff the watcher's line numbers refer to, defaulting to the old side
+func (w *Watcher) Side() string {
+	if w.LineSide == "" {
+		return OLD_SIDE
+	}
+	return w.LineSide
+}
+
+// SeverityLevel returns how important it is that the watcher triggered, defaulting to warning
+func (w *Watcher) SeverityLevel() string {
+	if w.Severity == "" {
+		return SEVERITY_WARNING
+	}
+	return w.Severity
 }
 
 func (w *Watcher) Validate() error {
@@ -56,26 +103,52 @@ func (w *Watcher) Validate() error {
 		validationErrors = append(validationErrors, errors.New("missing file path"))
 	}
 
-	if w.FilePath == "" {
-		validationErrors = append(validationErrors, errors.New("missing file path"))
+	for _, lines := range w.Lines {
+		if lines != FULL_FILE && (lines.StartLine < 1 || lines.EndLine < lines.StartLine) {
+			validationErrors = append(validationErrors, fmt.Errorf("invalid line range %s", lines))
+		}
 	}
-	return nil
-}
 
-func findWatcherForFileLocal(filePath string) ([]Watcher, error) {
-	s, err := GetLocalStore("")
-	if err != nil {
-		return nil, err
+	if w.LineSide != "" && w.LineSide != OLD_SIDE && w.LineSide != NEW_SIDE {
+		validationErrors = append(validationErrors, fmt.Errorf("line_side must be %s or %s, got %s", OLD_SIDE, NEW_SIDE, w.LineSide))
 	}
 
-	var result []Watcher
+	if w.Severity != "" && !ValidSeverity(w.Severity) {
+		validationErrors = append(validationErrors, fmt.Errorf("severity must be %s, %s or %s, got %s", SEVERITY_INFO, SEVERITY_WARNING, SEVERITY_ERROR, w.Severity))
+	}
 
-	for _, watcher := range s.Watchers {
-		if watcher.FilePath == filePath {
-			result = append(result, watcher)
+	for _, pattern := range w.RequiresChangeIn {
+		if !glob.Valid(pattern) {
+			validationErrors = append(validationErrors, fmt.Errorf("requires_change_in %q isn't a valid glob", pattern))
 		}
 	}
-	return result, nil
+
+	if w.Commit != nil {
+		validationErrors = append(validationErrors, w.Commit.Validate()...)
+	}
+
+	validationErrors = append(validationErrors, w.validateActive()...)
+	validationErrors = append(validationErrors, w.BranchFilters.Validate()...)
+
+	if w.Actions != nil {
+		for _, action := range *w.Actions {
+			if _, err := action.ActionTimeout(); err != nil {
+				validationErrors = append(validationErrors, fmt.Errorf("action %s has an invalid timeout: %s", action.ActionName(), err))
+			}
+			for _, err := range action.ActionBranchFilters().Validate() {
+				validationErrors = append(validationErrors, fmt.Errorf("action %s has an invalid %s", action.ActionName(), err))
+			}
+		}
+	}
+
+	if len(validationErrors) == 0 {
+		return nil
+	}
+	var messages []string
+	for _, err := range validationErrors {
+		messages = append(messages, err.Error())
+	}
+	return errors.New(strings.Join(messages, ", "))
 }
 
 func findWatcherForFileMongo(filePath string) ([]Watcher, error) {
@@ -0,0 +1,96 @@
+// Package state remembers what diffhook has already notified about between runs, so re-running it on the same change
+// (ex. on every push to a pull request) doesn't send the same notifications again.
+package state
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// DefaultFileName is the name of the state file when a directory is given
+const DefaultFileName = "diffhook-state.json"
+
+// Notifications older than this are forgotten, so the state doesn't grow forever
+const retention = 90 * 24 * time.Hour
+
+// Notification records the content a notification was sent for
+type Notification struct {
+	Hash   string    `json:"hash"`
+	SentAt time.Time `json:"sent_at"`
+}
+
+// File is the state, kept in a JSON file
+type File struct {
+	path          string
+	Notifications map[string]Notification `json:"notifications"`
+}
+
+// Load reads the state from the file, or from DefaultFileName in it if it's a directory (or ends in a slash). A missing
+// file is an empty state.
+func Load(path string) (*File, error) {
+	if info, err := os.Stat(path); (err == nil && info.IsDir()) || strings.HasSuffix(path, string(os.PathSeparator)) {
+		path = filepath.Join(path, DefaultFileName)
+	}
+
+	f := &File{path: path, Notifications: make(map[string]Notification)}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return f, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(data, f)
+	if err != nil {
+		return nil, err
+	}
+	if f.Notifications == nil {
+		f.Notifications = make(map[string]Notification)
+	}
+	return f, nil
+}
+
+// Path is the file the state is saved to
+func (f *File) Path() string {
+	return f.path
+}
+
+// Notified checks if a notification was already sent for the key with the same content
+func (f *File) Notified(key, hash string) bool {
+	notification, ok := f.Notifications[key]
+	return ok && notification.Hash == hash
+}
+
+// Record remembers that a notification was sent for the key's content
+func (f *File) Record(key, hash string, now time.Time) {
+	f.Notifications[key] = Notification{Hash: hash, SentAt: now}
+}
+
+// Save forgets notifications older than the retention and writes the state. The file is replaced in one go, so an
+// interrupted save can't leave it half written.
+func (f *File) Save(now time.Time) error {
+	for key, notification := range f.Notifications {
+		if now.Sub(notification.SentAt) > retention {
+			delete(f.Notifications, key)
+		}
+	}
+
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(f.path), 0755)
+	if err != nil {
+		return err
+	}
+	tmp := f.path + ".tmp"
+	err = ioutil.WriteFile(tmp, data, 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, f.path)
+}
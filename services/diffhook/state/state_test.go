@@ -0,0 +1,55 @@
+package state
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFile(t *testing.T) {
+	now := time.Date(2021, 6, 15, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		path func(dir string) string
+	}{
+		{name: "file", path: func(dir string) string { return filepath.Join(dir, "cache", "state.json") }},
+		{name: "directory", path: func(dir string) string { return dir }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := tt.path(t.TempDir())
+
+			f, err := Load(path)
+			require.Nil(t, err, "Error loading state: %s", err)
+			assert.False(t, f.Notified("watcher", "abc"))
+
+			f.Record("watcher", "abc", now)
+			f.Record("old", "def", now.Add(-100*24*time.Hour))
+			require.Nil(t, f.Save(now))
+
+			loaded, err := Load(path)
+			require.Nil(t, err, "Error loading state: %s", err)
+			assert.Equal(t, f.Path(), loaded.Path())
+			assert.True(t, loaded.Notified("watcher", "abc"))
+			assert.False(t, loaded.Notified("watcher", "changed"))
+			assert.False(t, loaded.Notified("old", "def"), "old notifications should be forgotten")
+		})
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	require.Nil(t, ioutil.WriteFile(path, []byte("{"), 0644))
+
+	_, err := Load(path)
+	assert.NotNil(t, err)
+
+	_, err = os.Stat(path)
+	assert.Nil(t, err, "the invalid state should be left alone")
+}
@@ -0,0 +1,90 @@
+package trigger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bennettaur/diffhook/services/diffhook/models"
+	"github.com/bennettaur/diffhook/services/diffhook/models/actions"
+)
+
+// Change is what's known about the change being evaluated besides its diff
+type Change struct {
+	// Commits that make up the change, needed for watchers with commit conditions
+	Commits []*actions.Commit
+	// Branches the change is being merged between, needed for watchers with branch filters
+	Branches *actions.Branches
+	// PullRequest is the description of the pull request the change is in, checked for skip directives
+	PullRequest *PullRequest
+	// Clock is when the change is being evaluated, for watchers' active windows and freezes. Defaults to time.Now.
+	Clock func() time.Time
+}
+
+type PullRequest struct {
+	Author string
+	Body   string
+}
+
+// Returns the change's branches, or nil if they aren't known
+func (c *Change) branches() *actions.Branches {
+	if c == nil {
+		return nil
+	}
+	return c.Branches
+}
+
+// Returns the time the change is being evaluated at
+func (c *Change) now() time.Time {
+	if c == nil || c.Clock == nil {
+		return time.Now()
+	}
+	return c.Clock()
+}
+
+type changeKey struct{}
+
+// WithChange returns a context that evaluates diffs as part of the change
+func WithChange(ctx context.Context, change *Change) context.Context {
+	return context.WithValue(ctx, changeKey{}, change)
+}
+
+func changeFrom(ctx context.Context) *Change {
+	change, _ := ctx.Value(changeKey{}).(*Change)
+	return change
+}
+
+var errNoCommits = errors.New("the watcher has commit conditions but there are no commits to check them against, use --git or pass the commit in with --author, --committer and --message")
+
+// Checks if any of the change's commits meet the conditions. Without any commits, or with a message expression that
+// doesn't compile, the conditions can't be checked, so they're treated as met and an error is returned.
+func matchCommits(conditions *models.CommitConditions, change *Change) (bool, string, error) {
+	if change == nil || len(change.Commits) == 0 {
+		return true, "no commits to check", errNoCommits
+	}
+
+	var reasons []string
+	for _, commit := range change.Commits {
+		matched, reason, err := conditions.Match(commit)
+		if err != nil {
+			return true, "commit conditions can't be checked", err
+		}
+		if matched {
+			return true, fmt.Sprintf("commit %s", commit), nil
+		}
+		if commit.SHA != "" {
+			reason = fmt.Sprintf("%s %s", shortSHA(commit.SHA), reason)
+		}
+		reasons = append(reasons, reason)
+	}
+	return false, strings.Join(reasons, "; "), nil
+}
+
+func shortSHA(sha string) string {
+	if len(sha) > 12 {
+		return sha[:12]
+	}
+	return sha
+}
@@ -0,0 +1,524 @@
+package trigger
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/bennettaur/diffhook/services/diffhook/models/actions"
+	"github.com/sourcegraph/go-diff/diff"
+)
+
+// MergeParent describes which parent of a merge commit a file diff read from a combined diff was generated against
+type MergeParent struct {
+	// Parent is the 1-based index of the parent the diff is relative to
+	Parent  int
+	Parents int
+	// Commit is the merge commit, if the diff has commit headers like `git log -p --cc` does
+	Commit string
+	// Resolutions are the ranges, in the parent's line numbers, where the merge result has lines that aren't in any
+	// of the parents. These are almost always where merge conflicts were resolved.
+	Resolutions []actions.LineRange
+	// NewResolutions are the same ranges in the merge result's line numbers
+	NewResolutions []actions.LineRange
+}
+
+// CombinedDiffReader reads the output of `git show <merge>`, `git log -p --cc` and friends. Combined (`diff --cc`)
+// file sections are split into one unified diff per merge parent so they can be evaluated like any other diff, and
+// regular `diff --git` sections are passed through as is. Anything outside of a file section, like commit headers,
+// is skipped.
+type CombinedDiffReader struct {
+	reader   *bufio.Reader
+	nextLine *string
+
+	pending []*diff.FileDiff
+	parents map[*diff.FileDiff]*MergeParent
+
+	current       *diff.FileDiff
+	currentParent *MergeParent
+	// The commit whose file sections are being read, if there are commit headers
+	commit string
+}
+
+func NewCombinedDiffReader(r io.Reader) *CombinedDiffReader {
+	return newCombinedDiffReader(readErrors{r})
+}
+
+func newCombinedDiffReader(r io.Reader) *CombinedDiffReader {
+	return &CombinedDiffReader{
+		reader:  bufio.NewReader(r),
+		parents: make(map[*diff.FileDiff]*MergeParent),
+	}
+}
+
+func (r *CombinedDiffReader) ReadFile() (*diff.FileDiff, error) {
+	for len(r.pending) == 0 {
+		err := r.readSection()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	fileDiff := r.pending[0]
+	r.pending = r.pending[1:]
+	r.current = fileDiff
+	r.currentParent = r.parents[fileDiff]
+	delete(r.parents, fileDiff)
+	return fileDiff, nil
+}
+
+// MergeParent returns the merge parent the most recently read file diff is relative to, or nil if it wasn't part of a
+// combined diff
+func (r *CombinedDiffReader) MergeParent(fileDiff *diff.FileDiff) *MergeParent {
+	if fileDiff != r.current {
+		return nil
+	}
+	return r.currentParent
+}
+
+func (r *CombinedDiffReader) readLine() (string, error) {
+	if r.nextLine != nil {
+		line := *r.nextLine
+		r.nextLine = nil
+		return line, nil
+	}
+
+	line, err := r.reader.ReadString('\n')
+	if err == io.EOF && line != "" {
+		err = nil
+	}
+	return strings.TrimSuffix(line, "\n"), err
+}
+
+func (r *CombinedDiffReader) unreadLine(line string) {
+	r.nextLine = &line
+}
+
+// Reads the next file section, skipping anything before it, and queues up the file diffs it produces
+func (r *CombinedDiffReader) readSection() error {
+	var header string
+	for {
+		line, err := r.readLine()
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(line, "diff ") {
+			header = line
+			break
+		}
+		if fields := strings.Fields(line); len(fields) > 1 && fields[0] == "commit" {
+			r.commit = fields[1]
+		}
+	}
+
+	var extended []string
+	var origName, newName string
+	extended = append(extended, header)
+	for {
+		line, err := r.readLine()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(line, "@@") || strings.HasPrefix(line, "diff ") || strings.HasPrefix(line, "commit ") {
+			r.unreadLine(line)
+			break
+		}
+
+		switch {
+		case strings.HasPrefix(line, "--- "):
+			origName = strings.TrimPrefix(line, "--- ")
+		case strings.HasPrefix(line, "+++ "):
+			newName = strings.TrimPrefix(line, "+++ ")
+		default:
+			extended = append(extended, line)
+		}
+	}
+
+	if isCombinedHeader(header) {
+		return r.readCombinedSection(extended, origName, newName)
+	}
+	return r.readUnifiedSection(extended, origName, newName)
+}
+
+func (r *CombinedDiffReader) readUnifiedSection(extended []string, origName, newName string) error {
+	if origName == "" && newName == "" {
+		// No hunks to read (renames, mode changes, binaries) so there's nothing go-diff can parse
+		r.pending = append(r.pending, headerOnlyFileDiff(extended))
+		return nil
+	}
+
+	var buf bytes.Buffer
+	for _, line := range extended {
+		buf.WriteString(line + "\n")
+	}
+	buf.WriteString("--- " + origName + "\n")
+	buf.WriteString("+++ " + newName + "\n")
+
+	for {
+		line, err := r.readLine()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if !strings.HasPrefix(line, "@@ ") {
+			r.unreadLine(line)
+			break
+		}
+
+		ranges, _, err := parseHunkHeader(line, 1)
+		if err != nil {
+			return err
+		}
+		buf.WriteString(line + "\n")
+
+		origLeft, newLeft := ranges[0].count, ranges[1].count
+		for origLeft > 0 || newLeft > 0 {
+			bodyLine, err := r.readLine()
+			if err != nil {
+				return fmt.Errorf("unexpected end of hunk in %s: %w", extended[0], err)
+			}
+			buf.WriteString(bodyLine + "\n")
+
+			switch {
+			case strings.HasPrefix(bodyLine, "-"):
+				origLeft--
+			case strings.HasPrefix(bodyLine, "+"):
+				newLeft--
+			case strings.HasPrefix(bodyLine, `\`):
+			default:
+				origLeft--
+				newLeft--
+			}
+		}
+		// A missing newline marker can follow the last line of the hunk
+		if line, err := r.readLine(); err == nil {
+			if strings.HasPrefix(line, `\`) {
+				buf.WriteString(line + "\n")
+			} else {
+				r.unreadLine(line)
+			}
+		}
+	}
+
+	fileDiff, err := diff.ParseFileDiff(buf.Bytes())
+	if err != nil {
+		return err
+	}
+	r.pending = append(r.pending, fileDiff)
+	return nil
+}
+
+// Builds the file diff for a section that's just headers, like a pure rename or a mode change
+func headerOnlyFileDiff(extended []string) *diff.FileDiff {
+	names := strings.SplitN(strings.TrimPrefix(extended[0], "diff --git "), " b/", 2)
+	fileDiff := &diff.FileDiff{OrigName: names[0], Extended: extended}
+	if len(names) == 2 {
+		fileDiff.NewName = "b/" + names[1]
+	}
+
+	for _, line := range extended[1:] {
+		switch {
+		case strings.HasPrefix(line, "new file mode "):
+			fileDiff.OrigName = "/dev/null"
+		case strings.HasPrefix(line, "deleted file mode "):
+			fileDiff.NewName = "/dev/null"
+		}
+	}
+	return fileDiff
+}
+
+type hunkRange struct {
+	start int
+	count int
+}
+
+// Parses a unified (@@) or combined (@@@) hunk header into one range per parent followed by the range in the result,
+// along with the section heading
+func parseHunkHeader(line string, parents int) ([]hunkRange, string, error) {
+	marker := strings.Repeat("@", parents+1)
+	if !strings.HasPrefix(line, marker+" ") {
+		return nil, "", fmt.Errorf("bad hunk header %q", line)
+	}
+
+	fields := strings.Fields(strings.TrimPrefix(line, marker))
+	if len(fields) < parents+2 || fields[parents+1] != marker {
+		return nil, "", fmt.Errorf("bad hunk header %q", line)
+	}
+
+	ranges := make([]hunkRange, parents+1)
+	for i, field := range fields[:parents+1] {
+		sign := "-"
+		if i == parents {
+			sign = "+"
+		}
+		if !strings.HasPrefix(field, sign) {
+			return nil, "", fmt.Errorf("bad hunk range %q in %q", field, line)
+		}
+
+		parts := strings.SplitN(field[1:], ",", 2)
+		start, err := strconv.Atoi(parts[0])
+		if err != nil {
+			return nil, "", fmt.Errorf("bad hunk range %q in %q", field, line)
+		}
+		count := 1
+		if len(parts) == 2 {
+			count, err = strconv.Atoi(parts[1])
+			if err != nil {
+				return nil, "", fmt.Errorf("bad hunk range %q in %q", field, line)
+			}
+		}
+		ranges[i] = hunkRange{start: start, count: count}
+	}
+
+	section := ""
+	if idx := strings.Index(line[len(marker):], marker); idx >= 0 {
+		section = strings.TrimSpace(line[len(marker)+idx+len(marker):])
+	}
+	return ranges, section, nil
+}
+
+type combinedLine struct {
+	columns string
+	content string
+}
+
+// Removed lines have a - in the column of every parent they were in. Anything else is in the result.
+func (l combinedLine) inResult() bool {
+	return !strings.Contains(l.columns, "-")
+}
+
+func (l combinedLine) inParent(parent int) bool {
+	if l.inResult() {
+		return l.columns[parent] == ' '
+	}
+	return l.columns[parent] == '-'
+}
+
+// A line that's in the result but none of the parents was written while merging
+func (l combinedLine) resolution() bool {
+	return strings.Count(l.columns, "+") == len(l.columns)
+}
+
+type combinedHunk struct {
+	ranges  []hunkRange
+	section string
+	lines   []combinedLine
+}
+
+func (r *CombinedDiffReader) readCombinedSection(extended []string, origName, newName string) error {
+	path := strings.TrimPrefix(strings.TrimPrefix(extended[0], "diff --cc "), "diff --combined ")
+	if origName == "" {
+		origName = "a/" + path
+	}
+	if newName == "" {
+		newName = "b/" + path
+	}
+
+	var hunks []combinedHunk
+	parents := 0
+	for {
+		line, err := r.readLine()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if !strings.HasPrefix(line, "@@@") {
+			r.unreadLine(line)
+			break
+		}
+
+		if parents == 0 {
+			parents = len(line) - len(strings.TrimLeft(line, "@")) - 1
+		}
+		ranges, section, err := parseHunkHeader(line, parents)
+		if err != nil {
+			return err
+		}
+
+		hunk := combinedHunk{ranges: ranges, section: section}
+		remaining := make([]int, parents+1)
+		for i, hr := range ranges {
+			remaining[i] = hr.count
+		}
+		for !allZero(remaining) {
+			bodyLine, err := r.readLine()
+			if err != nil {
+				return fmt.Errorf("unexpected end of hunk in %s: %w", extended[0], err)
+			}
+			if strings.HasPrefix(bodyLine, `\`) {
+				continue
+			}
+			if len(bodyLine) < parents {
+				return fmt.Errorf("bad combined diff line %q in %s", bodyLine, extended[0])
+			}
+
+			cl := combinedLine{columns: bodyLine[:parents], content: bodyLine[parents:]}
+			for i := 0; i < parents; i++ {
+				if cl.inParent(i) {
+					remaining[i]--
+				}
+			}
+			if cl.inResult() {
+				remaining[parents]--
+			}
+			hunk.lines = append(hunk.lines, cl)
+		}
+		hunks = append(hunks, hunk)
+	}
+
+	if parents == 0 {
+		// Nothing to split, ex. a mode change made while merging, so it's read as a header-only diff against the first
+		// parent
+		fileDiff := &diff.FileDiff{OrigName: origName, NewName: newName, Extended: parentExtendedHeaders(extended, 0)}
+		r.pending = append(r.pending, fileDiff)
+		r.parents[fileDiff] = &MergeParent{Parent: 1, Parents: combinedParents(extended), Commit: r.commit}
+		return nil
+	}
+
+	for parent := 0; parent < parents; parent++ {
+		fileDiff, mergeParent := splitCombinedHunks(hunks, parent, parents)
+		if len(fileDiff.Hunks) == 0 {
+			continue
+		}
+		mergeParent.Commit = r.commit
+		fileDiff.OrigName = origName
+		fileDiff.NewName = newName
+		fileDiff.Extended = parentExtendedHeaders(extended, parent)
+		r.pending = append(r.pending, fileDiff)
+		r.parents[fileDiff] = mergeParent
+	}
+	return nil
+}
+
+// Converts the combined hunks into the unified diff between one parent and the merge result, keeping track of the
+// conflict resolutions in the parent's and the result's line numbers
+func splitCombinedHunks(hunks []combinedHunk, parent, parents int) (*diff.FileDiff, *MergeParent) {
+	fileDiff := &diff.FileDiff{}
+	mergeParent := &MergeParent{Parent: parent + 1, Parents: parents}
+
+	for _, ch := range hunks {
+		var body bytes.Buffer
+		changed := false
+
+		parentLine := ch.ranges[parent].start
+		resultLine := ch.ranges[parents].start
+		inRun, runHasResolution := false, false
+		var run, resultRun actions.LineRange
+		endRun := func() {
+			if inRun && runHasResolution {
+				mergeParent.Resolutions = append(mergeParent.Resolutions, run)
+				mergeParent.NewResolutions = append(mergeParent.NewResolutions, resultRun)
+			}
+			inRun, runHasResolution = false, false
+		}
+
+		for _, line := range ch.lines {
+			inParent := line.inParent(parent)
+			inResult := line.inResult()
+			switch {
+			case inParent && inResult:
+				endRun()
+				body.WriteString(" " + line.content + "\n")
+				parentLine++
+				resultLine++
+				continue
+			case inParent:
+				body.WriteString("-" + line.content + "\n")
+			case inResult:
+				body.WriteString("+" + line.content + "\n")
+			default:
+				// Removed from another parent, so it doesn't exist on either side of this diff
+				continue
+			}
+
+			changed = true
+			if !inRun {
+				inRun = true
+				run = actions.LineRange{StartLine: parentLine, EndLine: parentLine}
+				resultRun = actions.LineRange{StartLine: resultLine, EndLine: resultLine}
+			}
+			if inParent {
+				run.EndLine = parentLine
+				parentLine++
+			}
+			if inResult {
+				resultRun.EndLine = resultLine
+				resultLine++
+			}
+			runHasResolution = runHasResolution || line.resolution()
+		}
+		endRun()
+
+		if !changed {
+			continue
+		}
+		fileDiff.Hunks = append(fileDiff.Hunks, &diff.Hunk{
+			OrigStartLine: int32(ch.ranges[parent].start),
+			OrigLines:     int32(ch.ranges[parent].count),
+			NewStartLine:  int32(ch.ranges[parents].start),
+			NewLines:      int32(ch.ranges[parents].count),
+			Section:       ch.section,
+			Body:          body.Bytes(),
+		})
+	}
+	return fileDiff, mergeParent
+}
+
+// Rewrites the combined `index <parent1>,<parent2>..<result>` header to only have the parent's blob id, and the
+// combined mode header to an old and new mode if the parent's mode changed, so the headers match the unified diff the
+// parent's file diff stands in for
+func parentExtendedHeaders(extended []string, parent int) []string {
+	var headers []string
+	for _, header := range extended {
+		switch {
+		case strings.HasPrefix(header, "index "):
+			fields := strings.Fields(strings.TrimPrefix(header, "index "))
+			ids := strings.SplitN(fields[0], "..", 2)
+			parentIds := strings.Split(ids[0], ",")
+			if len(ids) == 2 && parent < len(parentIds) {
+				fields[0] = parentIds[parent] + ".." + ids[1]
+				header = "index " + strings.Join(fields, " ")
+			}
+		case strings.HasPrefix(header, "mode "):
+			// Combined diffs list every parent's mode, ex. mode 100644,100644..100755
+			modes := strings.SplitN(strings.TrimPrefix(header, "mode "), "..", 2)
+			parentModes := strings.Split(modes[0], ",")
+			if len(modes) == 2 && parent < len(parentModes) && parentModes[parent] != modes[1] {
+				headers = append(headers, "old mode "+parentModes[parent], "new mode "+modes[1])
+				continue
+			}
+		}
+		headers = append(headers, header)
+	}
+	return headers
+}
+
+// Counts the merge's parents from the blob ids in the index header, ex. index 1111111,2222222..3333333
+func combinedParents(extended []string) int {
+	for _, header := range extended {
+		if strings.HasPrefix(header, "index ") {
+			ids := strings.SplitN(strings.Fields(strings.TrimPrefix(header, "index "))[0], "..", 2)
+			return strings.Count(ids[0], ",") + 1
+		}
+	}
+	return 2
+}
+
+func allZero(counts []int) bool {
+	for _, c := range counts {
+		if c > 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,73 @@
+package trigger
+
+import (
+	"fmt"
+)
+
+// Result is the outcome of evaluating a diff: the watchers it triggered, and everything that couldn't be evaluated
+type Result struct {
+	Triggered []TriggeredWatcher
+	// Skipped are watchers that would have triggered, but were skipped by a directive in a commit or pull request
+	Skipped []TriggeredWatcher
+	Errors  []error
+}
+
+// ParseError is a file in the diff that couldn't be parsed, so none of its watchers were checked
+type ParseError struct {
+	// File is the position of the file in the diff, starting from 0
+	File int
+	Err  error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("can't parse file(%d) of the diff: %s", e.File, e.Err)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// ReadError is the diff itself failing to be read (ex. the pipe it's read from breaking), as opposed to a file in it
+// not being formatted the way it should be. Nothing after it in the diff can be read.
+type ReadError struct {
+	Err error
+}
+
+func (e *ReadError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ReadError) Unwrap() error {
+	return e.Err
+}
+
+// StoreError is a store of watchers that couldn't be loaded or isn't valid
+type StoreError struct {
+	Path string
+	Err  error
+}
+
+func (e *StoreError) Error() string {
+	return fmt.Sprintf("can't load watchers from %s: %s", e.Path, e.Err)
+}
+
+func (e *StoreError) Unwrap() error {
+	return e.Err
+}
+
+// WatcherError is a watcher that couldn't be evaluated the way it's configured for a file. The watcher is still
+// evaluated as best it can be (ex. with its lines as configured if they can't be relocated), erring on the side of
+// triggering.
+type WatcherError struct {
+	Watcher  string
+	FilePath string
+	Err      error
+}
+
+func (e *WatcherError) Error() string {
+	return fmt.Sprintf("can't fully evaluate watcher %s for %s: %s", e.Watcher, e.FilePath, e.Err)
+}
+
+func (e *WatcherError) Unwrap() error {
+	return e.Err
+}
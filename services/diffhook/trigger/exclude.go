@@ -0,0 +1,123 @@
+package trigger
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/bennettaur/diffhook/services/diffhook/glob"
+	"github.com/bennettaur/diffhook/services/diffhook/models"
+	"github.com/sourcegraph/go-diff/diff"
+)
+
+// Attributes that mark a path in .gitattributes as not worth watching
+var excludeAttributes = []string{"linguist-generated", "linguist-vendored", "diffhook-ignore"}
+
+// A line of a .gitattributes file, with the state of each of the attributes it mentions. true is set, false is unset
+// or unspecified, and a missing attribute is left as it was.
+type gitattribute struct {
+	pattern    string
+	attributes map[string]bool
+}
+
+// exclusions decides which files in a diff are skipped entirely, from the store's exclude globs and, if enabled, the
+// repository's .gitattributes
+type exclusions struct {
+	globs         []string
+	gitattributes []gitattribute
+}
+
+func loadExclusions(store *models.LocalStore) *exclusions {
+	e := &exclusions{globs: store.Exclude}
+	if !store.UseGitattributes {
+		return e
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(store.Dir(), ".gitattributes"))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Warning: can't read .gitattributes: %s", err)
+		}
+		return e
+	}
+	e.gitattributes = parseGitattributes(data)
+	return e
+}
+
+// Returns the reason the file is excluded, or an empty string if it isn't
+func (e *exclusions) excluded(fileDiff *diff.FileDiff) string {
+	for _, name := range []string{fileDiff.OrigName, fileDiff.NewName} {
+		if name == "" || name == "/dev/null" {
+			continue
+		}
+		p := trimDiffPrefix(name)
+		if glob.MatchAny(e.globs, p) {
+			return "excluded by " + p
+		}
+		if attribute := e.attribute(p); attribute != "" {
+			return "marked " + attribute + " in .gitattributes"
+		}
+	}
+	return ""
+}
+
+// Returns the first of the exclude attributes set on the path, following git in letting later lines override earlier
+// ones
+func (e *exclusions) attribute(p string) string {
+	state := make(map[string]bool)
+	for _, line := range e.gitattributes {
+		if !gitattributeMatch(line.pattern, p) {
+			continue
+		}
+		for attribute, set := range line.attributes {
+			state[attribute] = set
+		}
+	}
+
+	for _, attribute := range excludeAttributes {
+		if state[attribute] {
+			return attribute
+		}
+	}
+	return ""
+}
+
+func parseGitattributes(data []byte) []gitattribute {
+	var lines []gitattribute
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		line := gitattribute{pattern: fields[0], attributes: make(map[string]bool)}
+		for _, field := range fields[1:] {
+			switch {
+			case strings.HasPrefix(field, "-"), strings.HasPrefix(field, "!"):
+				// Unset and unspecified both mean the path isn't excluded
+				line.attributes[field[1:]] = false
+			case strings.Contains(field, "="):
+				parts := strings.SplitN(field, "=", 2)
+				line.attributes[parts[0]] = parts[1] != "false"
+			default:
+				line.attributes[field] = true
+			}
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// Patterns without a slash match the file name in any directory, anything else is relative to the repository root
+func gitattributeMatch(pattern, p string) bool {
+	if !strings.Contains(pattern, "/") {
+		return glob.Match(pattern, path.Base(p))
+	}
+	return glob.Match(strings.TrimPrefix(pattern, "/"), p)
+}
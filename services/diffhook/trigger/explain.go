@@ -0,0 +1,208 @@
+package trigger
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/bennettaur/diffhook/services/diffhook/models"
+	"github.com/bennettaur/diffhook/services/diffhook/models/actions"
+	"github.com/sourcegraph/go-diff/diff"
+)
+
+// Check is one of the things compared while evaluating a watcher against a file
+type Check struct {
+	Condition string `json:"condition"`
+	Detail    string `json:"detail,omitempty"`
+	// Met is nil for checks that only record what was compared
+	Met *bool `json:"met,omitempty"`
+}
+
+// Explanation is how a watcher was evaluated against one file in the diff, or why it wasn't evaluated at all
+type Explanation struct {
+	Watcher  string  `json:"watcher"`
+	FilePath string  `json:"file_path"`
+	Diff     string  `json:"diff,omitempty"`
+	Checks   []Check `json:"checks"`
+	// Triggered is whether the watcher fired. Reason is the first thing that decided that, either way.
+	Triggered bool   `json:"triggered"`
+	Reason    string `json:"reason"`
+
+	// skipped is whether the watcher would have fired but was skipped, so its checks can still be resumed
+	skipped bool
+}
+
+// Trace records an Explanation for every watcher as a diff is evaluated, for working out why a watcher did or didn't
+// fire. Attach one to the context passed to TriggerWatchers or StreamWatchers with WithTrace.
+type Trace struct {
+	Explanations []*Explanation
+
+	current  *Explanation
+	excluded map[string]string
+}
+
+type traceKey struct{}
+
+// WithTrace returns a context that records an explanation of every watcher evaluated with it in the trace
+func WithTrace(ctx context.Context, trace *Trace) context.Context {
+	return context.WithValue(ctx, traceKey{}, trace)
+}
+
+func traceFrom(ctx context.Context) *Trace {
+	trace, _ := ctx.Value(traceKey{}).(*Trace)
+	return trace
+}
+
+// Filter returns the explanations for the named watcher
+func (t *Trace) Filter(watcher string) []*Explanation {
+	var result []*Explanation
+	for _, e := range t.Explanations {
+		if e.Watcher == watcher {
+			result = append(result, e)
+		}
+	}
+	return result
+}
+
+// All of the methods below do nothing on a nil trace, so evaluation doesn't need to check if it's being traced
+
+func (t *Trace) begin(watcher models.Watcher, fileDiff *diff.FileDiff, mergeParent *MergeParent) {
+	if t == nil {
+		return
+	}
+	t.current = &Explanation{
+		Watcher:  watcher.Name,
+		FilePath: watcher.FilePath,
+		Diff:     fmt.Sprintf("%s -> %s", fileDiff.OrigName, fileDiff.NewName),
+	}
+	if mergeParent != nil {
+		t.current.Diff = fmt.Sprintf("%s (merge parent %d of %d)", t.current.Diff, mergeParent.Parent, mergeParent.Parents)
+	}
+	t.Explanations = append(t.Explanations, t.current)
+}
+
+func (t *Trace) info(condition, detail string) {
+	if t == nil || t.current == nil {
+		return
+	}
+	t.current.Checks = append(t.current.Checks, Check{Condition: condition, Detail: detail})
+}
+
+// Records a condition being checked, returning whether it was met
+func (t *Trace) check(condition string, met bool, detail string) bool {
+	if t == nil || t.current == nil {
+		return met
+	}
+	t.current.Checks = append(t.current.Checks, Check{Condition: condition, Detail: detail, Met: &met})
+	return met
+}
+
+// Records whether the watched lines overlapped a change, if the check applies, returning whether they did
+func (t *Trace) checkOverlap(condition string, applies bool, lines *actions.TriggeredLines) bool {
+	if !applies {
+		return lines != nil
+	}
+	if lines == nil {
+		return t.check(condition, false, "no overlap")
+	}
+	return t.check(condition, true, fmt.Sprintf("watched %s overlaps changed %s", lines.WatchedLines, lines.DiffLines))
+}
+
+func (t *Trace) decide(triggered bool, reason string) {
+	if t == nil || t.current == nil {
+		return
+	}
+	t.current.Triggered = triggered
+	t.current.Reason = reason
+	t.current = nil
+}
+
+// Decides a watcher that fired, which doesn't count as triggered if the change skips it
+func (t *Trace) decideTriggered(tw *TriggeredWatcher) {
+	if t == nil || t.current == nil {
+		return
+	}
+	if tw.Skip != nil {
+		t.current.skipped = true
+		t.decide(false, fmt.Sprintf("%s, but %s", tw.Reason, tw.Skip))
+		return
+	}
+	t.decide(true, tw.Reason)
+}
+
+func (t *Trace) exclude(fileDiff *diff.FileDiff, reason string) {
+	if t == nil {
+		return
+	}
+	if t.excluded == nil {
+		t.excluded = make(map[string]string)
+	}
+	t.excluded[fileDiff.OrigName] = reason
+}
+
+// Picks the explanation of a watcher that triggered on the file back up, to record the checks that can only be made
+// once the whole diff has been read
+func (t *Trace) resume(watcher, origName string) {
+	if t == nil {
+		return
+	}
+	for i := len(t.Explanations) - 1; i >= 0; i-- {
+		e := t.Explanations[i]
+		if e.Watcher == watcher && (e.Triggered || e.skipped) && strings.HasPrefix(e.Diff, origName+" ") {
+			t.current = e
+			return
+		}
+	}
+}
+
+// Explains every watcher that wasn't evaluated against any file in the diff
+func (t *Trace) finish(index *Index, files int) {
+	if t == nil {
+		return
+	}
+	explained := make(map[string]bool)
+	for _, e := range t.Explanations {
+		explained[e.Watcher+"\x00"+e.FilePath] = true
+	}
+
+	for _, watcher := range index.all {
+		if explained[watcher.Name+"\x00"+watcher.FilePath] {
+			continue
+		}
+		e := &Explanation{Watcher: watcher.Name, FilePath: watcher.FilePath}
+		if reason, ok := t.excluded[watcher.FilePath]; ok {
+			e.Reason = "File skipped, " + reason
+		} else {
+			e.Reason = fmt.Sprintf("None of the %d files in the diff are %s", files, watcher.FilePath)
+		}
+		t.Explanations = append(t.Explanations, e)
+	}
+}
+
+// WriteExplanations prints the explanations in a human readable form
+func WriteExplanations(w io.Writer, explanations []*Explanation) {
+	for _, e := range explanations {
+		outcome := "not triggered"
+		if e.Triggered {
+			outcome = "triggered"
+		}
+		fmt.Fprintf(w, "%s (%s): %s, %s\n", e.Watcher, e.FilePath, outcome, e.Reason)
+		if e.Diff != "" {
+			fmt.Fprintf(w, "  diff %s\n", e.Diff)
+		}
+		for _, c := range e.Checks {
+			marker := "   "
+			if c.Met != nil && *c.Met {
+				marker = "[x]"
+			} else if c.Met != nil {
+				marker = "[ ]"
+			}
+			if c.Detail == "" {
+				fmt.Fprintf(w, "  %s %s\n", marker, c.Condition)
+			} else {
+				fmt.Fprintf(w, "  %s %s: %s\n", marker, c.Condition, c.Detail)
+			}
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package trigger
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/bennettaur/diffhook/services/diffhook/models"
+	"github.com/bennettaur/diffhook/services/diffhook/models/actions"
+	"github.com/sourcegraph/go-diff/diff"
+)
+
+// FingerprintContext is how many lines around a watched range are included in its fingerprint
+const FingerprintContext = 3
+
+// Fraction of a fingerprint's line hashes that have to match for a fuzzy match to be trusted
+const fuzzyMatchThreshold = 0.6
+
+// NewFingerprint fingerprints the lines in the range, plus some lines of context around it, of the file's content
+func NewFingerprint(content []byte, lines actions.LineRange) models.Fingerprint {
+	fileLines := splitLines(content)
+	start := clampLine(lines.StartLine-1-FingerprintContext, len(fileLines))
+	end := clampLine(lines.EndLine+FingerprintContext, len(fileLines))
+
+	fingerprint := models.Fingerprint{
+		Lines:         lines,
+		Hash:          hashLines(fileLines, lines.StartLine-1, lines.EndLine),
+		ContextBefore: clampLine(lines.StartLine-1, len(fileLines)) - start,
+	}
+	for _, line := range fileLines[start:end] {
+		fingerprint.LineHashes = append(fingerprint.LineHashes, hashLine(line))
+	}
+	return fingerprint
+}
+
+// Finds where the fingerprinted lines are in the file's content. An exact match of the lines is preferred, closest to
+// where they were when fingerprinted, falling back to the best fuzzy match of the lines and their context.
+func locateFingerprint(fingerprint *models.Fingerprint, content []byte) (actions.LineRange, bool) {
+	fileLines := splitLines(content)
+	length := fingerprint.Lines.EndLine - fingerprint.Lines.StartLine + 1
+	if length <= 0 {
+		return fingerprint.Lines, false
+	}
+
+	bestStart, bestDistance := -1, 0
+	for start := 0; start+length <= len(fileLines); start++ {
+		if hashLines(fileLines, start, start+length) != fingerprint.Hash {
+			continue
+		}
+		distance := abs(start + 1 - fingerprint.Lines.StartLine)
+		if bestStart < 0 || distance < bestDistance {
+			bestStart, bestDistance = start, distance
+		}
+	}
+
+	if bestStart < 0 {
+		bestScore := 0.0
+		for offset := -len(fingerprint.LineHashes); offset < len(fileLines); offset++ {
+			start := offset + fingerprint.ContextBefore
+			if start < 0 || start+length > len(fileLines) {
+				continue
+			}
+			score := fuzzyScore(fingerprint.LineHashes, fileLines, offset)
+			distance := abs(start + 1 - fingerprint.Lines.StartLine)
+			if score > bestScore || (score == bestScore && bestStart >= 0 && distance < bestDistance) {
+				bestScore, bestStart, bestDistance = score, start, distance
+			}
+		}
+		if bestScore < fuzzyMatchThreshold || bestStart < 0 {
+			return fingerprint.Lines, false
+		}
+	}
+
+	return actions.LineRange{StartLine: bestStart + 1, EndLine: bestStart + length}, true
+}
+
+// Moves each of the watcher's fingerprinted line ranges to where the lines are on the watcher's side of the diff. If
+// the file can't be read from the source the lines are returned as they are, along with the error. The lines are
+// always a copy, since the watcher's are shared with the index.
+func relocateLines(source Source, watcher models.Watcher, fileDiff *diff.FileDiff) ([]actions.LineRange, error) {
+	relocated := append([]actions.LineRange(nil), watcher.Lines...)
+	if len(watcher.Fingerprints) == 0 {
+		return relocated, nil
+	}
+
+	read := source.Old
+	if watcher.Side() == models.NEW_SIDE {
+		read = source.New
+	}
+	content, err := read(fileDiff)
+	if err != nil {
+		return relocated, fmt.Errorf("can't read the file to locate the fingerprinted lines: %w", err)
+	}
+
+	for i, lines := range watcher.Lines {
+		fingerprint := watcher.FingerprintFor(lines)
+		// The whole file can't have moved anywhere, even if an older fingerprint says it has
+		if fingerprint == nil || lines == models.FULL_FILE {
+			continue
+		}
+
+		found, ok := locateFingerprint(fingerprint, content)
+		if !ok {
+			log.Printf("Warning: watcher %s can't find the lines it watched at %s in %s, the lines may have changed too much. Re-run diffhook fingerprint", watcher.Name, lines, fileDiff.OrigName)
+			continue
+		}
+		if found != lines {
+			log.Printf("Watcher %s lines %s have moved to %s", watcher.Name, lines, found)
+			relocated[i] = found
+		}
+	}
+	return relocated, nil
+}
+
+func fuzzyScore(lineHashes []string, fileLines []string, offset int) float64 {
+	matches := 0
+	for i, lineHash := range lineHashes {
+		fileLine := offset + i
+		if fileLine < 0 || fileLine >= len(fileLines) {
+			continue
+		}
+		if hashLine(fileLines[fileLine]) == lineHash {
+			matches++
+		}
+	}
+	return float64(matches) / float64(len(lineHashes))
+}
+
+func splitLines(content []byte) []string {
+	return strings.Split(strings.TrimSuffix(string(content), "\n"), "\n")
+}
+
+// Whitespace changes like re-indenting shouldn't stop the lines from being found
+func normaliseLine(line string) string {
+	return strings.Join(strings.Fields(line), " ")
+}
+
+func hashLine(line string) string {
+	sum := sha256.Sum256([]byte(normaliseLine(line)))
+	return hex.EncodeToString(sum[:4])
+}
+
+// Hashes the lines in [start, end), clamped to the lines in the file
+func hashLines(fileLines []string, start, end int) string {
+	start = clampLine(start, len(fileLines))
+	end = clampLine(end, len(fileLines))
+
+	hash := sha256.New()
+	for _, line := range fileLines[start:end] {
+		hash.Write([]byte(normaliseLine(line) + "\n"))
+	}
+	return hex.EncodeToString(hash.Sum(nil)[:16])
+}
+
+func clampLine(line, lineCount int) int {
+	if line < 0 {
+		return 0
+	}
+	if line > lineCount {
+		return lineCount
+	}
+	return line
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
@@ -0,0 +1,228 @@
+package trigger
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"reflect"
+	"strings"
+
+	"github.com/bennettaur/diffhook/services/diffhook/models"
+	"github.com/bennettaur/diffhook/services/diffhook/models/actions"
+	"github.com/sourcegraph/go-diff/diff"
+)
+
+// Parts of the AST that change with formatting or comments and are skipped when comparing declarations. Objects and
+// scopes are derived from the rest of the tree, and can refer back to the nodes that contain them. Positions are only
+// compared on whether they're set, since some mark syntax, ex. the = of a type alias or the ... of a variadic call.
+var (
+	posType          = reflect.TypeOf(token.NoPos)
+	commentGroupType = reflect.TypeOf(&ast.CommentGroup{})
+	objectType       = reflect.TypeOf(&ast.Object{})
+	scopeType        = reflect.TypeOf(&ast.Scope{})
+)
+
+// Checks if the Go declarations in the watcher's lines are the same on both sides of the diff once positions and
+// comments are ignored, meaning the change was only to formatting (ex. gofmt, reordered imports or re-wrapped lines).
+// Anything that can't be compared, like files that don't parse, counts as a real change and is returned as an error.
+func formattingOnly(source Source, watcher models.Watcher, fileDiff *diff.FileDiff) (bool, error) {
+	if !strings.HasSuffix(fileDiff.OrigName, ".go") || deleted(fileDiff) {
+		return false, nil
+	}
+
+	oldContent, err := source.Old(fileDiff)
+	if err != nil {
+		return false, fmt.Errorf("can't read the old file to compare formatting: %w", err)
+	}
+	newContent, err := source.New(fileDiff)
+	if err != nil {
+		return false, fmt.Errorf("can't read the new file to compare formatting: %w", err)
+	}
+
+	// The watched lines are only numbered on one side, so map them through the diff to find them on the other
+	oldLines := watcher.Lines
+	newLines := watcher.Lines
+	if watcher.Side() == models.NEW_SIDE {
+		oldLines = mapLineRanges(invertHunks(fileDiff.Hunks), watcher.Lines)
+	} else {
+		newLines = mapLineRanges(fileDiff.Hunks, watcher.Lines)
+	}
+
+	oldDecls, err := watchedDeclarations(oldContent, oldLines)
+	if err != nil {
+		return false, fmt.Errorf("can't parse the old file to compare formatting: %w", err)
+	}
+	newDecls, err := watchedDeclarations(newContent, newLines)
+	if err != nil {
+		return false, fmt.Errorf("can't parse the new file to compare formatting: %w", err)
+	}
+
+	if len(oldDecls) != len(newDecls) {
+		return false, nil
+	}
+	for key, oldDecl := range oldDecls {
+		newDecl, ok := newDecls[key]
+		if !ok || !astEqual(reflect.ValueOf(oldDecl), reflect.ValueOf(newDecl)) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// Maps each of the ranges from the old side of the diff to the new side
+func mapLineRanges(hunks []*diff.Hunk, lines []actions.LineRange) []actions.LineRange {
+	mapped := make([]actions.LineRange, len(lines))
+	for i, r := range lines {
+		mapped[i] = mapLineRange(hunks, r)
+	}
+	return mapped
+}
+
+// Swaps the sides of the hunks, so line numbers on the new side can be mapped back to the old side
+func invertHunks(hunks []*diff.Hunk) []*diff.Hunk {
+	inverted := make([]*diff.Hunk, len(hunks))
+	for i, hunk := range hunks {
+		var body bytes.Buffer
+		for _, line := range bytes.SplitAfter(hunk.Body, []byte("\n")) {
+			if len(line) > 0 && line[0] == '+' {
+				body.WriteByte('-')
+				line = line[1:]
+			} else if len(line) > 0 && line[0] == '-' {
+				body.WriteByte('+')
+				line = line[1:]
+			}
+			body.Write(line)
+		}
+		inverted[i] = &diff.Hunk{
+			OrigStartLine: hunk.NewStartLine,
+			OrigLines:     hunk.NewLines,
+			NewStartLine:  hunk.OrigStartLine,
+			NewLines:      hunk.OrigLines,
+			Body:          body.Bytes(),
+		}
+	}
+	return inverted
+}
+
+// Parses the file and returns the package clause, imports, functions, types, variables and constants that overlap the
+// line ranges, keyed by what they declare so they can be matched up regardless of where they are in the file
+func watchedDeclarations(content []byte, lines []actions.LineRange) (map[string]ast.Node, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", content, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	decls := make(map[string]ast.Node)
+	add := func(key string, node ast.Node, start, end token.Pos) {
+		if !overlapsAny(fset.Position(start).Line, fset.Position(end).Line, lines) {
+			return
+		}
+		// Functions like init can be declared more than once
+		unique := key
+		for i := 2; decls[unique] != nil; i++ {
+			unique = fmt.Sprintf("%s#%d", key, i)
+		}
+		decls[unique] = node
+	}
+
+	add("package", file.Name, file.Package, file.Name.End())
+	for _, decl := range file.Decls {
+		switch decl := decl.(type) {
+		case *ast.FuncDecl:
+			key := "func " + decl.Name.Name
+			if decl.Recv != nil && len(decl.Recv.List) > 0 {
+				key = fmt.Sprintf("func (%s) %s", types.ExprString(decl.Recv.List[0].Type), decl.Name.Name)
+			}
+			add(key, decl, decl.Pos(), decl.End())
+		case *ast.GenDecl:
+			for _, spec := range decl.Specs {
+				start, end := spec.Pos(), spec.End()
+				if !decl.Lparen.IsValid() {
+					// Ungrouped declarations start at the keyword
+					start, end = decl.Pos(), decl.End()
+				}
+				add(specKey(decl.Tok, spec), spec, start, end)
+			}
+		}
+	}
+	return decls, nil
+}
+
+func specKey(tok token.Token, spec ast.Spec) string {
+	switch spec := spec.(type) {
+	case *ast.ImportSpec:
+		return "import " + spec.Path.Value
+	case *ast.TypeSpec:
+		return "type " + spec.Name.Name
+	case *ast.ValueSpec:
+		var names []string
+		for _, name := range spec.Names {
+			names = append(names, name.Name)
+		}
+		return tok.String() + " " + strings.Join(names, ", ")
+	}
+	return tok.String()
+}
+
+func overlapsAny(start, end int, lines []actions.LineRange) bool {
+	for _, r := range lines {
+		if r.StartLine < 0 || r.EndLine < 0 {
+			return true
+		}
+		if r.StartLine <= end && start <= r.EndLine {
+			return true
+		}
+	}
+	return false
+}
+
+// Compares two AST values field by field, skipping comments, resolved objects and where things are
+func astEqual(a, b reflect.Value) bool {
+	if a.Type() != b.Type() {
+		return false
+	}
+	switch a.Type() {
+	case posType:
+		return token.Pos(a.Int()).IsValid() == token.Pos(b.Int()).IsValid()
+	case commentGroupType, objectType, scopeType:
+		return true
+	}
+
+	switch a.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if a.IsNil() || b.IsNil() {
+			return a.IsNil() == b.IsNil()
+		}
+		return astEqual(a.Elem(), b.Elem())
+	case reflect.Struct:
+		for i := 0; i < a.NumField(); i++ {
+			if !astEqual(a.Field(i), b.Field(i)) {
+				return false
+			}
+		}
+		return true
+	case reflect.Slice:
+		if a.Len() != b.Len() {
+			return false
+		}
+		for i := 0; i < a.Len(); i++ {
+			if !astEqual(a.Index(i), b.Index(i)) {
+				return false
+			}
+		}
+		return true
+	case reflect.String:
+		return a.String() == b.String()
+	case reflect.Bool:
+		return a.Bool() == b.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return a.Int() == b.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return a.Uint() == b.Uint()
+	}
+	return false
+}
@@ -0,0 +1,65 @@
+package trigger
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/bennettaur/diffhook/services/diffhook/models"
+	"github.com/bennettaur/diffhook/services/diffhook/models/actions"
+	"github.com/sourcegraph/go-diff/diff"
+)
+
+// Triggers every freeze that's active and covers either side of the file's diff. Each is triggered like a watcher named
+// after the freeze, watching the file, with the freeze's actions. Like watchers, a freeze is only triggered once per
+// file in a merge, rather than once for each parent.
+func frozenChanges(freezes []models.Freeze, fileDiff *diff.FileDiff, mergeParent *MergeParent, merged mergeTriggers, now time.Time, skips []*Skip, trace *Trace) []TriggeredWatcher {
+	var triggered []TriggeredWatcher
+	for _, freeze := range freezes {
+		mergeKey := "freeze " + freeze.Name
+		if !freeze.Active(now) || merged.seen(mergeParent, mergeKey, fileDiff) {
+			continue
+		}
+		path := frozenPath(freeze, fileDiff)
+		if path == "" {
+			continue
+		}
+
+		filePath := fileDiff.OrigName
+		if filePath == "/dev/null" {
+			filePath = fileDiff.NewName
+		}
+		watcher := models.Watcher{Name: freeze.Name, FilePath: filePath, Severity: freeze.SeverityLevel(), Actions: freeze.Actions}
+		if watcher.Actions == nil {
+			watcher.Actions = &actions.Actions{}
+		}
+		tw := TriggeredWatcher{
+			FileDiff: fileDiff,
+			Watcher:  watcher,
+			Reason:   fmt.Sprintf("Change during freeze %s", freeze.Name),
+		}
+
+		trace.begin(watcher, fileDiff, nil)
+		trace.check("freeze", true, fmt.Sprintf("%s is frozen from %s to %s", path, freeze.Start, freeze.End))
+		if skip := skipForFreeze(skips, freeze); skip != nil {
+			trace.check("skip", true, skip.String())
+			tw.Skip = skip
+		}
+		trace.decideTriggered(&tw)
+		merged.add(mergeParent, mergeKey, fileDiff)
+		triggered = append(triggered, tw)
+	}
+	return triggered
+}
+
+// Returns the path on either side of the diff that the freeze covers, or "" if it doesn't cover the file
+func frozenPath(freeze models.Freeze, fileDiff *diff.FileDiff) string {
+	for _, name := range []string{fileDiff.OrigName, fileDiff.NewName} {
+		if name == "" || name == "/dev/null" {
+			continue
+		}
+		if p := trimDiffPrefix(name); freeze.Covers(p) {
+			return p
+		}
+	}
+	return ""
+}
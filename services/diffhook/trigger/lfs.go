@@ -0,0 +1,101 @@
+package trigger
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/bennettaur/diffhook/services/diffhook/models"
+	"github.com/bennettaur/diffhook/services/diffhook/models/actions"
+	"github.com/sourcegraph/go-diff/diff"
+)
+
+const lfsVersionPrefix = "version https://git-lfs.github.com/spec/"
+
+// Parses a Git LFS pointer file change out of the diff, returning nil if either side of the diff isn't a pointer file.
+// Added or deleted assets will only have the new or old side filled in respectively.
+func parseAssetChange(fileDiff *diff.FileDiff) *actions.AssetChange {
+	if len(fileDiff.Hunks) == 0 {
+		return nil
+	}
+
+	change := &actions.AssetChange{Path: trimDiffPrefix(fileDiff.NewName)}
+	if fileDiff.NewName == "/dev/null" {
+		change.Path = trimDiffPrefix(fileDiff.OrigName)
+	}
+
+	for _, hunk := range fileDiff.Hunks {
+		scanner := bufio.NewScanner(bytes.NewReader(hunk.Body))
+		for scanner.Scan() {
+			line := scanner.Text()
+			if len(line) == 0 || line == `\ No newline at end of file` {
+				continue
+			}
+
+			prefix, content := line[0], line[1:]
+			inOrig := prefix == ' ' || prefix == '-'
+			inNew := prefix == ' ' || prefix == '+'
+			if !inOrig && !inNew {
+				return nil
+			}
+
+			key := strings.SplitN(content, " ", 2)[0]
+			value := strings.TrimSpace(strings.TrimPrefix(content, key))
+			switch {
+			case strings.HasPrefix(content, lfsVersionPrefix):
+				// Usually unchanged context, and missing entirely from diffs generated without context
+			case key == "oid":
+				if !strings.HasPrefix(value, "sha256:") {
+					return nil
+				}
+				if inOrig {
+					change.OldOid = value
+				}
+				if inNew {
+					change.NewOid = value
+				}
+			case key == "size":
+				size, err := strconv.ParseInt(value, 10, 64)
+				if err != nil {
+					return nil
+				}
+				if inOrig {
+					change.OldSize = size
+				}
+				if inNew {
+					change.NewSize = size
+				}
+			case strings.HasPrefix(key, "ext-"):
+				// Extension lines are valid in a pointer but we don't report on them
+			default:
+				return nil
+			}
+		}
+	}
+
+	if change.OldOid == "" && change.NewOid == "" {
+		return nil
+	}
+	return change
+}
+
+// Checks if the asset behind an LFS pointer was replaced and, when the watcher has a growth condition, whether the new
+// asset is large enough to meet it. Without the sizes the growth can't be checked, so any replacement is reported.
+func assetReplaced(w models.Watcher, change *actions.AssetChange) (bool, string) {
+	if change == nil || change.OldOid == "" || change.NewOid == "" || change.OldOid == change.NewOid {
+		return false, ""
+	}
+
+	if w.AssetGrowthPercent > 0 && !change.SizesKnown() {
+		return true, "Asset Replaced, Growth Unknown"
+	}
+	if w.AssetGrowthPercent > 0 {
+		if change.GrowthPercent() <= w.AssetGrowthPercent {
+			return false, ""
+		}
+		return true, fmt.Sprintf("Asset Grew More Than %g%%", w.AssetGrowthPercent)
+	}
+	return true, "Asset Replaced"
+}
@@ -0,0 +1,63 @@
+package trigger
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+
+	"github.com/sourcegraph/go-diff/diff"
+)
+
+// FileDiffReader reads a multi-file diff one file at a time, returning io.EOF once there are no files left.
+// diff.MultiFileDiffReader satisfies it for plain unified diffs.
+type FileDiffReader interface {
+	ReadFile() (*diff.FileDiff, error)
+}
+
+// NewDiffReader picks the reader for the kind of diff in r. Plain `git diff` output is read with go-diff, while
+// combined diffs from merge commits and the output of `git show`/`git log -p` (which have commit headers between
+// files) are read with a CombinedDiffReader.
+func NewDiffReader(r io.Reader) FileDiffReader {
+	reader := bufio.NewReader(readErrors{r})
+
+	var peeked bytes.Buffer
+	combined := false
+	for {
+		line, err := reader.ReadBytes('\n')
+		peeked.Write(line)
+
+		text := string(line)
+		if strings.HasPrefix(text, "commit ") || isCombinedHeader(text) {
+			combined = true
+			break
+		}
+		if strings.HasPrefix(text, "diff ") || err != nil {
+			break
+		}
+	}
+
+	full := io.MultiReader(&peeked, reader)
+	if combined {
+		return newCombinedDiffReader(full)
+	}
+	return diff.NewMultiFileDiffReader(full)
+}
+
+// Marks the errors from reading the underlying diff as ReadErrors, so they can be told apart from the diff being
+// malformed once they come back out of the diff parsers
+type readErrors struct {
+	r io.Reader
+}
+
+func (r readErrors) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if err != nil && err != io.EOF {
+		err = &ReadError{Err: err}
+	}
+	return n, err
+}
+
+func isCombinedHeader(line string) bool {
+	return strings.HasPrefix(line, "diff --cc ") || strings.HasPrefix(line, "diff --combined ")
+}
@@ -0,0 +1,180 @@
+package trigger
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+
+	"github.com/bennettaur/diffhook/services/diffhook/models"
+	"github.com/bennettaur/diffhook/services/diffhook/models/actions"
+)
+
+// SkipTrailer is the trailer (or line in a pull request description) that skips watchers by name or tag, or all of
+// them with "all"
+const SkipTrailer = "Diffhook-Skip"
+
+const skipAll = "all"
+
+var (
+	skipMarker   = regexp.MustCompile(`(?i)\[skip diffhook\]`)
+	skipBodyLine = regexp.MustCompile(`(?im)^\s*` + SkipTrailer + `:\s*(.+?)\s*$`)
+)
+
+// Skip records who asked for a watcher to be skipped, and where, so skipped watchers can still be audited
+type Skip struct {
+	// Target is the watcher name or tag that was skipped, or "all"
+	Target string
+	// By is who asked for the skip, if it's known
+	By string
+	// Source is where the skip was asked for, ex. a commit
+	Source string
+}
+
+func (s *Skip) String() string {
+	by := s.By
+	if by == "" {
+		by = "unknown"
+	}
+	return fmt.Sprintf("skipped by %s in %s (%s)", by, s.Source, s.Target)
+}
+
+// Collects the skip directives in the change's commit messages and pull request description
+func (c *Change) skips() []*Skip {
+	if c == nil {
+		return nil
+	}
+
+	var commitSkips [][]*Skip
+	for _, commit := range c.Commits {
+		commitSkips = append(commitSkips, skipsInCommit(commit))
+	}
+	skips := rangeSkips(commitSkips)
+
+	if c.PullRequest != nil {
+		if skipMarker.MatchString(c.PullRequest.Body) {
+			skips = append(skips, &Skip{Target: skipAll, By: c.PullRequest.Author, Source: "the pull request description"})
+		}
+		for _, match := range skipBodyLine.FindAllStringSubmatch(c.PullRequest.Body, -1) {
+			for _, target := range splitTargets(match[1]) {
+				skips = append(skips, &Skip{Target: target, By: c.PullRequest.Author, Source: "the pull request description"})
+			}
+		}
+	}
+	return skips
+}
+
+func skipsInCommit(commit *actions.Commit) []*Skip {
+	source := "commit " + shortSHA(commit.SHA)
+	if commit.SHA == "" {
+		source = "the commit message"
+	}
+
+	var skips []*Skip
+	if skipMarker.MatchString(commit.Message) {
+		skips = append(skips, &Skip{Target: skipAll, By: commit.Author, Source: source})
+	}
+	for key, values := range commit.Trailers {
+		if !strings.EqualFold(key, SkipTrailer) {
+			continue
+		}
+		for _, value := range values {
+			for _, target := range splitTargets(value) {
+				skips = append(skips, &Skip{Target: target, By: commit.Author, Source: source})
+			}
+		}
+	}
+	return skips
+}
+
+// A commit's skips are only meant for the lines it changed, but when several commits are evaluated as one diff there's
+// no telling which lines those are. So their skips only apply if every commit asks for them, otherwise the commits
+// have to be evaluated one at a time for the skips to apply to the commits that ask for them.
+func rangeSkips(commitSkips [][]*Skip) []*Skip {
+	if len(commitSkips) == 1 {
+		return commitSkips[0]
+	}
+
+	var skips []*Skip
+	decided := make(map[string]bool)
+	for _, skipsInCommit := range commitSkips {
+		for _, skip := range skipsInCommit {
+			target := strings.ToLower(skip.Target)
+			if decided[target] {
+				continue
+			}
+			decided[target] = true
+
+			var by []string
+			for _, other := range commitSkips {
+				otherSkip := skipTargeting(other, skip.Target)
+				if otherSkip == nil {
+					by = nil
+					break
+				}
+				by = appendUnique(by, otherSkip.By)
+			}
+			if by == nil {
+				log.Printf("Ignoring the skip of %s in %s, not every commit in the diff skips it. Evaluate the commits one at a time (--per-commit) to skip it for just the commits that ask", skip.Target, skip.Source)
+				continue
+			}
+			skips = append(skips, &Skip{Target: skip.Target, By: strings.Join(by, ", "), Source: fmt.Sprintf("all %d commits", len(commitSkips))})
+		}
+	}
+	return skips
+}
+
+func skipTargeting(skips []*Skip, target string) *Skip {
+	for _, skip := range skips {
+		if strings.EqualFold(skip.Target, target) {
+			return skip
+		}
+	}
+	return nil
+}
+
+func appendUnique(values []string, value string) []string {
+	for _, v := range values {
+		if v == value {
+			return values
+		}
+	}
+	return append(values, value)
+}
+
+// Several watchers can be skipped in one directive, separated by commas
+func splitTargets(value string) []string {
+	var targets []string
+	for _, target := range strings.Split(value, ",") {
+		if target = strings.TrimSpace(target); target != "" {
+			targets = append(targets, target)
+		}
+	}
+	return targets
+}
+
+// Finds the first skip that names the freeze. Freezes are deliberately left out of skipping "all", so a change can't
+// get around a freeze without saying so.
+func skipForFreeze(skips []*Skip, freeze models.Freeze) *Skip {
+	for _, skip := range skips {
+		if strings.EqualFold(skip.Target, freeze.Name) {
+			return skip
+		}
+	}
+	return nil
+}
+
+// Finds the first skip that applies to the watcher
+func skipFor(skips []*Skip, watcher models.Watcher) *Skip {
+	for _, skip := range skips {
+		if strings.EqualFold(skip.Target, skipAll) || strings.EqualFold(skip.Target, watcher.Name) {
+			return skip
+		}
+		for _, tag := range watcher.Tags {
+			if strings.EqualFold(skip.Target, tag) {
+				return skip
+			}
+		}
+	}
+	return nil
+}
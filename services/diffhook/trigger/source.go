@@ -0,0 +1,86 @@
+package trigger
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/sourcegraph/go-diff/diff"
+)
+
+// Source loads the full contents of the file on either side of a diff, for checks that need more than the hunks
+type Source interface {
+	Old(fileDiff *diff.FileDiff) ([]byte, error)
+	New(fileDiff *diff.FileDiff) ([]byte, error)
+}
+
+// GitSource reads files from the local git object store using the blob ids in the diff's index header. If the new
+// side isn't in the object store (ex. diffs of uncommitted changes) it's read from the working tree instead.
+type GitSource struct {
+	// Dir is the root of the repository the diff is from, or the working directory if it's empty
+	Dir string
+}
+
+func (s GitSource) Old(fileDiff *diff.FileDiff) ([]byte, error) {
+	origBlob, _ := blobIds(fileDiff)
+	if origBlob == "" {
+		return nil, errors.New("no blob id for " + fileDiff.OrigName)
+	}
+	return s.catBlob(origBlob)
+}
+
+func (s GitSource) New(fileDiff *diff.FileDiff) ([]byte, error) {
+	_, newBlob := blobIds(fileDiff)
+	if newBlob != "" {
+		if content, err := s.catBlob(newBlob); err == nil {
+			return content, nil
+		}
+	}
+	if deleted(fileDiff) {
+		return nil, errors.New(fileDiff.OrigName + " was deleted")
+	}
+	return ioutil.ReadFile(filepath.Join(s.Dir, trimDiffPrefix(fileDiff.NewName)))
+}
+
+// Parses the blob ids out of the `index <orig>..<new> <mode>` header. Files that don't exist on a side have an id of
+// all zeros, which is returned as an empty string.
+func blobIds(fileDiff *diff.FileDiff) (string, string) {
+	for _, header := range fileDiff.Extended {
+		if !strings.HasPrefix(header, "index ") {
+			continue
+		}
+
+		fields := strings.Fields(strings.TrimPrefix(header, "index "))
+		if len(fields) == 0 {
+			return "", ""
+		}
+		ids := strings.SplitN(fields[0], "..", 2)
+		if len(ids) != 2 {
+			return "", ""
+		}
+		return nonZero(ids[0]), nonZero(ids[1])
+	}
+	return "", ""
+}
+
+func nonZero(id string) string {
+	if strings.Trim(id, "0") == "" {
+		return ""
+	}
+	return id
+}
+
+func (s GitSource) catBlob(id string) ([]byte, error) {
+	var stdout bytes.Buffer
+	gitCmd := exec.Command("git", "cat-file", "blob", id)
+	gitCmd.Dir = s.Dir
+	gitCmd.Stdout = &stdout
+	err := gitCmd.Run()
+	if err != nil {
+		return nil, err
+	}
+	return stdout.Bytes(), nil
+}
@@ -0,0 +1,109 @@
+package trigger
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/bennettaur/diffhook/services/diffhook/models/actions"
+	"github.com/sourcegraph/go-diff/diff"
+)
+
+const subprojectPrefix = "Subproject commit "
+
+// Parses a submodule pointer change out of the diff, returning nil if the diff isn't for a submodule. Added or removed
+// submodules will have an empty old or new commit respectively.
+func parseSubmoduleChange(fileDiff *diff.FileDiff) *actions.SubmoduleChange {
+	if len(fileDiff.Hunks) != 1 {
+		return nil
+	}
+
+	change := &actions.SubmoduleChange{Path: trimDiffPrefix(fileDiff.NewName)}
+	if fileDiff.NewName == "/dev/null" {
+		change.Path = trimDiffPrefix(fileDiff.OrigName)
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(fileDiff.Hunks[0].Body))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if len(line) == 0 || !strings.HasPrefix(line[1:], subprojectPrefix) {
+			return nil
+		}
+
+		commit := strings.TrimSpace(line[1+len(subprojectPrefix):])
+		// Submodules with local changes are marked as dirty, but the commit is still the part we care about
+		commit = strings.TrimSuffix(commit, "-dirty")
+		switch line[0] {
+		case '-':
+			change.OldCommit = commit
+		case '+':
+			change.NewCommit = commit
+		default:
+			return nil
+		}
+	}
+
+	if change.OldCommit == change.NewCommit {
+		return nil
+	}
+	return change
+}
+
+// Fills in the commit count and short log between the two commits if the submodule is checked out locally and has
+// both of the commits available. The submodule's path is relative to dir, the root of the repository.
+func loadSubmoduleHistory(dir string, change *actions.SubmoduleChange) {
+	if change.OldCommit == "" || change.NewCommit == "" {
+		return
+	}
+	path := filepath.Join(dir, change.Path)
+	if _, err := os.Stat(filepath.Join(path, ".git")); err != nil {
+		return
+	}
+
+	commitRange := change.OldCommit + ".." + change.NewCommit
+	count, err := gitOutput(path, "rev-list", "--count", commitRange)
+	if err != nil {
+		return
+	}
+	commits, err := strconv.Atoi(strings.TrimSpace(count))
+	if err != nil {
+		return
+	}
+
+	shortLog, err := gitOutput(path, "log", "--oneline", "--no-decorate", commitRange)
+	if err != nil {
+		return
+	}
+
+	change.CheckedOut = true
+	change.Commits = commits
+	change.Log = nil
+	for _, line := range strings.Split(strings.TrimSpace(shortLog), "\n") {
+		if line != "" {
+			change.Log = append(change.Log, line)
+		}
+	}
+}
+
+func gitOutput(dir string, args ...string) (string, error) {
+	var stdout bytes.Buffer
+	gitCmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	gitCmd.Stdout = &stdout
+	err := gitCmd.Run()
+	if err != nil {
+		return "", err
+	}
+	return stdout.String(), nil
+}
+
+// Strips the a/ or b/ prefix git adds to file names in a diff
+func trimDiffPrefix(name string) string {
+	if strings.HasPrefix(name, "a/") || strings.HasPrefix(name, "b/") {
+		return name[2:]
+	}
+	return name
+}
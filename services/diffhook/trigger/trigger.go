@@ -1,12 +1,19 @@
 package trigger
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"path/filepath"
 	"sort"
+	"strings"
 
+	"github.com/bennettaur/diffhook/services/diffhook/glob"
+	"github.com/bennettaur/diffhook/services/diffhook/interval"
 	"github.com/bennettaur/diffhook/services/diffhook/models"
 	"github.com/bennettaur/diffhook/services/diffhook/models/actions"
 	"github.com/sourcegraph/go-diff/diff"
@@ -17,14 +24,204 @@ type TriggeredWatcher struct {
 	TriggeredLines *actions.TriggeredLines
 	Watcher        models.Watcher
 	Reason         string
+	Submodule      *actions.SubmoduleChange
+	Asset          *actions.AssetChange
+	Commit         *actions.Commit
+	// Skip is set if the watcher was skipped by a directive, in which case its actions shouldn't be run
+	Skip *Skip
 }
 
-func TriggerWatchers(diffReader *diff.MultiFileDiffReader) []TriggeredWatcher {
+// ActionTrigger builds the details passed to each of the watcher's actions
+func (tw *TriggeredWatcher) ActionTrigger() *actions.Trigger {
+	return &actions.Trigger{
+		WatcherName: tw.Watcher.Name,
+		FilePath:    tw.Watcher.FilePath,
+		Reason:      tw.Reason,
+		Lines:       tw.TriggeredLines,
+		Submodule:   tw.Submodule,
+		Asset:       tw.Asset,
+		Commit:      tw.Commit,
+	}
+}
+
+// ContentHash identifies what triggered the watcher: the reason, the file's paths and the changed lines in every hunk
+// that overlaps the watched lines, or in every hunk if it wasn't triggered by its lines. Line numbers aren't included,
+// so the hash only changes when the triggering content does.
+func (tw *TriggeredWatcher) ContentHash() string {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s\x00%s\x00%s\x00", tw.Reason, tw.FileDiff.OrigName, tw.FileDiff.NewName)
+	hunks := tw.FileDiff.Hunks
+	if tw.TriggeredLines != nil && tw.TriggeredLines.Hunk != nil {
+		hunks = overlappingHunks(tw.FileDiff, tw.TriggeredLines)
+	}
+	for _, hunk := range hunks {
+		hash.Write(hunk.Body)
+	}
+	if tw.Submodule != nil {
+		fmt.Fprintf(hash, "%s\x00%s", tw.Submodule.OldCommit, tw.Submodule.NewCommit)
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// Finds the hunks that change the triggered watched lines, on the side of the diff the lines are on. The triggering
+// hunk is always included.
+func overlappingHunks(fileDiff *diff.FileDiff, lines *actions.TriggeredLines) []*diff.Hunk {
+	diffLines := getDiffLineRanges(fileDiff)
+	if lines.Side == models.NEW_SIDE {
+		diffLines = getNewDiffLineRanges(fileDiff)
+	}
+
+	var hunks []*diff.Hunk
+	found := false
+	for i, changed := range diffLines {
+		if changed.EndLine < changed.StartLine {
+			changed.EndLine = changed.StartLine
+		}
+		hunk := fileDiff.Hunks[i]
+		if hunk == lines.Hunk || overlapsAny(changed.StartLine, changed.EndLine, []actions.LineRange{lines.WatchedLines}) {
+			found = found || hunk == lines.Hunk
+			hunks = append(hunks, hunk)
+		}
+	}
+	if !found {
+		hunks = append(hunks, lines.Hunk)
+	}
+	return hunks
+}
+
+// Deduplicate drops watchers that were triggered for the same reason on the same lines as an earlier one. When
+// evaluating a range of commits one at a time, the first commit to trigger the watcher is the one that's kept.
+func Deduplicate(triggeredWatchers []TriggeredWatcher) []TriggeredWatcher {
+	seen := make(map[string]bool)
+	var result []TriggeredWatcher
+	for _, tw := range triggeredWatchers {
+		key := fmt.Sprintf("%s\x00%s\x00%s", tw.Watcher.Name, tw.Watcher.FilePath, tw.Reason)
+		if tw.TriggeredLines != nil {
+			key = fmt.Sprintf("%s\x00%s", key, tw.TriggeredLines.WatchedLines)
+		}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		result = append(result, tw)
+	}
+	return result
+}
+
+// Implemented by readers that split merge commits into a diff per parent, like CombinedDiffReader
+type mergeParentReader interface {
+	MergeParent(fileDiff *diff.FileDiff) *MergeParent
+}
+
+// Merges are evaluated once per parent, but each watcher (or freeze) should only be triggered once per file in each
+// merge. Keyed by the merge commit, the name and the file.
+type mergeTriggers map[string]bool
+
+func (m mergeTriggers) key(mergeParent *MergeParent, name string, fileDiff *diff.FileDiff) string {
+	return mergeParent.Commit + "\x00" + name + "\x00" + fileDiff.OrigName
+}
+
+// Checks if the name was already triggered for the file by another parent of the merge. Files that aren't from a merge
+// are never seen.
+func (m mergeTriggers) seen(mergeParent *MergeParent, name string, fileDiff *diff.FileDiff) bool {
+	return mergeParent != nil && m[m.key(mergeParent, name, fileDiff)]
+}
+
+func (m mergeTriggers) add(mergeParent *MergeParent, name string, fileDiff *diff.FileDiff) {
+	if mergeParent != nil {
+		m[m.key(mergeParent, name, fileDiff)] = true
+	}
+}
+
+// Index is a validated store of watchers, ready to evaluate diffs against. It's built once and can be reused for any
+// number of diffs.
+type Index struct {
+	all      []models.Watcher
+	watchers *models.Index
+	exclude  *exclusions
+	freezes  []models.Freeze
+	// dir is the root of the repository the store watches, which submodule paths are relative to
+	dir string
+	// source reads the full files in the diff for the checks that need more than its hunks
+	source Source
+}
+
+// NewIndex validates the store and indexes its watchers. Invalid stores are returned as a *StoreError.
+func NewIndex(store *models.LocalStore) (*Index, error) {
+	if err := store.Validate(); err != nil {
+		return nil, &StoreError{Path: store.Path(), Err: err}
+	}
+	return &Index{
+		all:      store.Watchers,
+		watchers: models.NewIndex(store.Watchers),
+		exclude:  loadExclusions(store),
+		freezes:  store.Freezes,
+		dir:      store.Dir(),
+		source:   GitSource{Dir: store.Dir()},
+	}, nil
+}
+
+// WithSource returns a copy of the index that reads the full files in a diff from the source instead of from git
+func (index *Index) WithSource(source Source) *Index {
+	withSource := *index
+	withSource.source = source
+	return &withSource
+}
+
+// LoadIndex loads the configured store and indexes it
+func LoadIndex() (*Index, error) {
+	store, err := models.GetLocalStore("")
+	if err != nil {
+		return nil, &StoreError{Path: models.ConfiguredLocalStore(), Err: err}
+	}
+	return NewIndex(store)
+}
+
+// TriggerWatchers evaluates the whole diff, returning every triggered or skipped watcher and anything that couldn't be
+// evaluated
+func TriggerWatchers(ctx context.Context, index *Index, diffReader FileDiffReader) *Result {
+	result := &Result{}
+	result.Errors = StreamWatchers(ctx, index, diffReader, func(tw TriggeredWatcher) bool {
+		if tw.Skip != nil {
+			result.Skipped = append(result.Skipped, tw)
+		} else {
+			result.Triggered = append(result.Triggered, tw)
+		}
+		return true
+	})
+	return result
+}
+
+// StreamWatchers evaluates the diff one file at a time, calling yield with each triggered watcher as soon as the file
+// it's in has been evaluated. Nothing from a file's diff is held on to after that, except for watchers that require a
+// change in other files: they can only be decided once the whole diff has been read, so they're yielded at the end.
+// Watchers skipped by a directive in the change are yielded too, with their Skip set. Returning false from yield, or ctx
+// being done, stops reading the diff.
+//
+// Files that can't be parsed (a *ParseError) and watchers that can't be fully evaluated (a *WatcherError) don't stop
+// the rest of the diff from being evaluated, and are returned once it has been. The diff failing to be read at all (a
+// *ParseError wrapping a *ReadError) stops it, since every file after it would fail too.
+func StreamWatchers(ctx context.Context, index *Index, diffReader FileDiffReader, yield func(TriggeredWatcher) bool) []error {
 	log.Println("Starting")
+	trace := traceFrom(ctx)
+	change := changeFrom(ctx)
+	skips := change.skips()
+	// Every watcher and freeze is checked against the same time, even if the diff takes a while to evaluate
+	now := change.now()
 
-	var triggeredWatchers []TriggeredWatcher
+	var errs []error
+	files := 0
+	// Watchers that require a change in other files can only be decided once every file in the diff has been seen
+	var pendingWatchers []TriggeredWatcher
+	changedPaths := make(map[string]bool)
+	merged := make(mergeTriggers)
+	// The last error reading the diff, to tell when the reader is stuck returning the same one
+	var readErr error
 	for i := 0; ; i++ {
 		fileIndex := fmt.Sprintf("file(%d)", i)
+		if ctx.Err() != nil {
+			return append(errs, fmt.Errorf("stopped before %s: %w", fileIndex, ctx.Err()))
+		}
 		log.Printf("Reading %s", fileIndex)
 		fileDiff, err := diffReader.ReadFile()
 
@@ -32,37 +229,147 @@ func TriggerWatchers(diffReader *diff.MultiFileDiffReader) []TriggeredWatcher {
 			break
 		}
 		if err != nil {
+			if errors.Is(err, readErr) {
+				log.Printf("Stopping, the reader is stuck on %s", err)
+				break
+			}
 			log.Printf("err reading file %s: %s", fileIndex, err)
+			errs = append(errs, &ParseError{File: i, Err: err})
+			// Only a malformed file can be skipped over, the diff failing to be read would fail every file after it too
+			var readFailed *ReadError
+			if errors.As(err, &readFailed) {
+				log.Printf("Stopping, the rest of the diff can't be read")
+				break
+			}
+			readErr = err
+			continue
+		}
+		readErr = nil
+		files++
+
+		// Excluded files still count as changes for watchers that require a change in them
+		for _, p := range diffPaths(fileDiff) {
+			changedPaths[p] = true
+		}
+
+		var mergeParent *MergeParent
+		if mr, ok := diffReader.(mergeParentReader); ok {
+			mergeParent = mr.MergeParent(fileDiff)
+		}
+
+		// Any change to a frozen file counts, even to files that are otherwise excluded
+		for _, tw := range frozenChanges(index.freezes, fileDiff, mergeParent, merged, now, skips, trace) {
+			if !yield(tw) {
+				log.Println("Stopping early")
+				return errs
+			}
+		}
+
+		if reason := index.exclude.excluded(fileDiff); reason != "" {
+			log.Printf("Skipping %s (%s), %s", fileIndex, fileDiff.OrigName, reason)
+			trace.exclude(fileDiff, reason)
 			continue
 		}
 
 		// Assumes hunks are sorted
 		changedLineRanges := getDiffLineRanges(fileDiff)
+		newChangedLineRanges := getNewDiffLineRanges(fileDiff)
+		asset := parseAssetChange(fileDiff)
+		if asset != nil {
+			// LFS pointer files are stand-ins for the asset, so their lines changing isn't a meaningful line change
+			changedLineRanges = nil
+			newChangedLineRanges = nil
+		}
 		log.Printf("Found the following line changes in %s: %v", fileIndex, changedLineRanges)
-		watchers, err := models.FindWatchersForFile(fileDiff.OrigName)
-
-		if err != nil {
-			log.Printf("err getting watchers for file %s: %s", fileDiff.OrigName, err)
+		candidates := watchersFor(index.watchers, fileDiff, changedLineRanges, newChangedLineRanges)
+		if len(candidates) == 0 {
 			continue
 		}
+		if mergeParent != nil {
+			log.Printf("%s is relative to merge parent %d of %d", fileIndex, mergeParent.Parent, mergeParent.Parents)
+		}
+
+		submodule := parseSubmoduleChange(fileDiff)
+		submoduleHistoryLoaded := false
+
+		for _, candidate := range candidates {
+			watcher := candidate.watcher
+			if merged.seen(mergeParent, watcher.Name, fileDiff) {
+				continue
+			}
 
-		for _, watcher := range watchers {
 			log.Printf("Checking watcher %s", watcher.Name)
-			sort.Slice(watcher.Lines, func(i, j int) bool {
-				return watcher.Lines[i].StartLine < watcher.Lines[j].StartLine
-			})
+			trace.begin(watcher, fileDiff, mergeParent)
+			if watcher.ActiveFrom != "" || watcher.ActiveUntil != "" || watcher.SnoozedUntil != "" {
+				active, detail := watcher.Active(now)
+				if !trace.check("active", active, detail) {
+					log.Printf("Watcher %s skipped, %s", watcher.Name, detail)
+					trace.decide(false, "Not active, "+detail)
+					continue
+				}
+			}
+			if !watcher.BranchFilters.IsZero() {
+				allowed, detail := watcher.BranchFilters.Allows(change.branches())
+				if !trace.check("branches", allowed, detail) {
+					log.Printf("Watcher %s skipped, %s", watcher.Name, detail)
+					trace.decide(false, "Not watching this branch")
+					continue
+				}
+			}
+			// Fingerprinted lines can move from diff to diff, so they can't be indexed ahead of time
+			fingerprinted := len(watcher.Fingerprints) > 0
+			if fingerprinted {
+				var err error
+				watcher.Lines, err = relocateLines(index.source, watcher, fileDiff)
+				if err != nil {
+					errs = append(errs, &WatcherError{Watcher: watcher.Name, FilePath: fileDiff.OrigName, Err: err})
+				}
+				sort.Slice(watcher.Lines, func(i, j int) bool {
+					return watcher.Lines[i].StartLine < watcher.Lines[j].StartLine
+				})
+			}
+
+			diffLines := changedLineRanges
+			if watcher.Side() == models.NEW_SIDE {
+				diffLines = newChangedLineRanges
+			}
+			trace.info("changed_lines", fmt.Sprintf("%v on the %s side", diffLines, watcher.Side()))
+			trace.info("watched_lines", fmt.Sprintf("%v", watcher.Lines))
 
 			var triggeredWatcher *TriggeredWatcher
+			notTriggered := "Watched lines weren't changed"
 
-			if triggered, reason := specialTrigger(watcher, changedLineRanges, fileDiff); triggered {
+			if triggered, reason := specialTrigger(watcher, diffLines, fileDiff, submodule, asset, trace); triggered {
 				triggeredWatcher = &TriggeredWatcher{
 					FileDiff:       fileDiff,
 					TriggeredLines: nil,
 					Watcher:        watcher,
 					Reason:         reason,
 				}
+			} else if triggeredLines := findResolutionOverlap(mergeParent, watcher.Lines, fileDiff, watcher.Side()); trace.checkOverlap("merge_conflict_resolution", mergeParent != nil, triggeredLines) {
+				triggeredWatcher = &TriggeredWatcher{
+					FileDiff:       fileDiff,
+					TriggeredLines: triggeredLines,
+					Watcher:        watcher,
+					Reason:         "Merge Conflict Resolution",
+				}
 			} else {
-				triggeredLines := findOverlap(changedLineRanges, watcher.Lines, fileDiff)
+				triggeredLines := candidate.overlap
+				if fingerprinted {
+					triggeredLines = findOverlap(diffLines, watcher.Lines, fileDiff)
+				}
+				trace.checkOverlap("watched_lines_changed", true, triggeredLines)
+				if triggeredLines != nil && watcher.IgnoreFormatting {
+					onlyFormatting, err := formattingOnly(index.source, watcher, fileDiff)
+					if err != nil {
+						errs = append(errs, &WatcherError{Watcher: watcher.Name, FilePath: fileDiff.OrigName, Err: err})
+					}
+					if trace.check("ignore_formatting", onlyFormatting, "") {
+						log.Printf("Watcher %s only had formatting changes to its lines", watcher.Name)
+						triggeredLines = nil
+						notTriggered = "Only the formatting of the watched lines changed"
+					}
+				}
 				if triggeredLines != nil {
 					triggeredWatcher = &TriggeredWatcher{
 						FileDiff:       fileDiff,
@@ -73,12 +380,93 @@ func TriggerWatchers(diffReader *diff.MultiFileDiffReader) []TriggeredWatcher {
 				}
 			}
 
+			if triggeredWatcher != nil && watcher.Commit != nil {
+				matched, detail, err := matchCommits(watcher.Commit, change)
+				if err != nil {
+					errs = append(errs, &WatcherError{Watcher: watcher.Name, FilePath: fileDiff.OrigName, Err: err})
+				}
+				if !trace.check("commit", matched, detail) {
+					log.Printf("Watcher %s skipped, no commit met its commit conditions: %s", watcher.Name, detail)
+					triggeredWatcher = nil
+					notTriggered = "No commit met the commit conditions"
+				}
+			}
+
 			if triggeredWatcher != nil {
-				triggeredWatchers = append(triggeredWatchers, *triggeredWatcher)
+				if skip := skipFor(skips, watcher); skip != nil {
+					trace.check("skip", true, skip.String())
+					triggeredWatcher.Skip = skip
+				}
 			}
+
+			if triggeredWatcher == nil {
+				trace.decide(false, notTriggered)
+			} else {
+				trace.decideTriggered(triggeredWatcher)
+				if triggeredWatcher.TriggeredLines != nil {
+					triggeredWatcher.TriggeredLines.Side = watcher.Side()
+				}
+				merged.add(mergeParent, watcher.Name, fileDiff)
+				if submodule != nil {
+					if !submoduleHistoryLoaded {
+						loadSubmoduleHistory(index.dir, submodule)
+						submoduleHistoryLoaded = true
+					}
+					triggeredWatcher.Submodule = submodule
+				}
+				triggeredWatcher.Asset = asset
+
+				if len(watcher.RequiresChangeIn) > 0 {
+					pendingWatchers = append(pendingWatchers, *triggeredWatcher)
+				} else if !yield(*triggeredWatcher) {
+					log.Println("Stopping early")
+					return errs
+				}
+			}
+		}
+	}
+
+	for _, tw := range pendingWatchers {
+		trace.resume(tw.Watcher.Name, tw.FileDiff.OrigName)
+		required := strings.Join(tw.Watcher.RequiresChangeIn, ", ")
+		if trace.check("requires_change_in", coChanged(tw.Watcher.RequiresChangeIn, changedPaths), "a change in "+required) {
+			log.Printf("Watcher %s has a matching change in %v", tw.Watcher.Name, tw.Watcher.RequiresChangeIn)
+			trace.decide(false, "Changed along with "+required)
+			continue
+		}
+		tw.Reason = fmt.Sprintf("%s without a change in %s", tw.Reason, required)
+		trace.decideTriggered(&tw)
+		if !yield(tw) {
+			return errs
+		}
+	}
+	trace.finish(index, files)
+	return errs
+}
+
+// Returns the paths of both sides of the diff, as they appear in the diff and with the a/ and b/ prefixes removed
+func diffPaths(fileDiff *diff.FileDiff) []string {
+	var paths []string
+	for _, name := range []string{fileDiff.OrigName, fileDiff.NewName} {
+		if name == "" || name == "/dev/null" {
+			continue
+		}
+		paths = append(paths, name)
+		if trimmed := trimDiffPrefix(name); trimmed != name {
+			paths = append(paths, trimmed)
 		}
 	}
-	return triggeredWatchers
+	return paths
+}
+
+// Checks if any of the changed paths match one of the required paths or globs
+func coChanged(required []string, changedPaths map[string]bool) bool {
+	for p := range changedPaths {
+		if glob.MatchAny(required, p) {
+			return true
+		}
+	}
+	return false
 }
 
 func getDiffLineRanges(fileDiff *diff.FileDiff) []actions.LineRange {
@@ -99,45 +487,144 @@ func getDiffLineRanges(fileDiff *diff.FileDiff) []actions.LineRange {
 	return ranges
 }
 
-// Compares the two sets of line ranges for any overlaps and returns the indices of the overlapping line ranges
-// or -1 if no overlap is found
-func findOverlap(diffLines, watchedLines []actions.LineRange, fileDiff *diff.FileDiff) *actions.TriggeredLines {
-	var diffIndex, watchIndex int
-
-	for {
-		// Check if we've run out of diffs or watchers to check
-		if watchIndex >= len(watchedLines) || diffIndex >= len(diffLines) {
-			return nil
-		}
-
-		// Check we overlap or are inside the diff range
-		if watchedLines[watchIndex].StartLine >= diffLines[diffIndex].StartLine {
-			// Check if start line is within the diff range and return
-			if watchedLines[watchIndex].StartLine <= diffLines[diffIndex].EndLine {
-				return &actions.TriggeredLines{
-					DiffLines: diffLines[diffIndex],
-					WatchedLines: watchedLines[watchIndex],
-					Hunk: fileDiff.Hunks[diffIndex],
-				}
+// Same as getDiffLineRanges, but in the line numbers of the new side of the diff
+func getNewDiffLineRanges(fileDiff *diff.FileDiff) []actions.LineRange {
+	var ranges []actions.LineRange
+	for _, hunk := range fileDiff.Hunks {
+		changeStartLine := int(hunk.NewStartLine) + 3
+		changeEndLine := changeStartLine + int(hunk.NewLines) - 6
+
+		ranges = append(
+			ranges,
+			actions.LineRange{
+				StartLine: changeStartLine,
+				EndLine:   changeEndLine,
+			},
+		)
+	}
+	return ranges
+}
+
+// A watcher to check against a file in the diff, along with the first change to its indexed lines
+type candidateWatcher struct {
+	watcher models.Watcher
+	overlap *actions.TriggeredLines
+}
+
+// Finds the watchers to check against the file diff. Watchers are found by the file's old path, but watchers of the new
+// side are also looking for the file at its new path, which is the only path a file added in the diff has.
+func watchersFor(watchers *models.Index, fileDiff *diff.FileDiff, oldLines, newLines []actions.LineRange) []candidateWatcher {
+	var candidates []candidateWatcher
+	add := func(filePath string, newSideOnly bool) {
+		file := watchers.File(filePath)
+		if file == nil {
+			return
+		}
+		overlaps := indexedOverlaps(file, oldLines, newLines, fileDiff)
+		for i, watcher := range file.Watchers {
+			if newSideOnly && watcher.Side() != models.NEW_SIDE {
+				continue
 			}
+			candidates = append(candidates, candidateWatcher{watcher: watcher, overlap: overlaps[i]})
+		}
+	}
 
-			// Current watchline is greater than diff, so advance the diff
-			diffIndex += 1
-			continue
+	if fileDiff.OrigName != "/dev/null" {
+		add(fileDiff.OrigName, false)
+	}
+	if fileDiff.NewName != "/dev/null" && fileDiff.NewName != "" {
+		if newPath := "a/" + trimDiffPrefix(fileDiff.NewName); newPath != fileDiff.OrigName {
+			add(newPath, true)
 		}
+	}
+	return candidates
+}
+
+// Finds the first change that each of the file's watchers overlaps, keyed by the watcher's position in the file index
+func indexedOverlaps(file *models.FileIndex, oldLines, newLines []actions.LineRange, fileDiff *diff.FileDiff) map[int]*actions.TriggeredLines {
+	overlaps := make(map[int]*actions.TriggeredLines)
+	findOverlaps(oldLines, fileDiff, func(lines actions.LineRange) []models.WatchedRange {
+		return file.Overlapping(models.OLD_SIDE, lines)
+	}, overlaps)
+	findOverlaps(newLines, fileDiff, func(lines actions.LineRange) []models.WatchedRange {
+		return file.Overlapping(models.NEW_SIDE, lines)
+	}, overlaps)
+	return overlaps
+}
 
-		// Check if our end overlaps the start
-		if watchedLines[watchIndex].EndLine >= diffLines[diffIndex].StartLine {
-			return &actions.TriggeredLines{
-				DiffLines: diffLines[diffIndex],
-				WatchedLines: watchedLines[watchIndex],
-				Hunk: fileDiff.Hunks[diffIndex],
+// Finds the first change to the watched lines, for lines that can't be indexed ahead of time (ex. fingerprinted lines
+// that have moved), in the same way as the indexed watchers' lines. The diff lines are paired with the diff's hunks by
+// index.
+func findOverlap(diffLines, watchedLines []actions.LineRange, fileDiff *diff.FileDiff) *actions.TriggeredLines {
+	intervals := make([]interval.Interval, len(watchedLines))
+	for i, lines := range watchedLines {
+		intervals[i] = interval.Interval{Start: lines.StartLine, End: lines.EndLine}
+	}
+	tree := interval.New(intervals)
+
+	overlaps := make(map[int]*actions.TriggeredLines)
+	findOverlaps(diffLines, fileDiff, func(lines actions.LineRange) []models.WatchedRange {
+		var watched []models.WatchedRange
+		for _, i := range tree.Overlapping(lines.StartLine, lines.EndLine) {
+			watched = append(watched, models.WatchedRange{Lines: actions.LineRange{StartLine: i.Start, EndLine: i.End}})
+		}
+		return watched
+	}, overlaps)
+	return overlaps[0]
+}
+
+// Records the first changed range that overlaps each watcher's lines, along with the first of its watched ranges that
+// the change overlaps. overlapping looks up the watched ranges that overlap a change.
+func findOverlaps(diffLines []actions.LineRange, fileDiff *diff.FileDiff, overlapping func(actions.LineRange) []models.WatchedRange, overlaps map[int]*actions.TriggeredLines) {
+	for i, lines := range diffLines {
+		if lines.EndLine < lines.StartLine {
+			// Hunks with less than 3 lines of context on either side end up with an inverted range
+			lines.EndLine = lines.StartLine
+		}
+		for _, watched := range overlapping(lines) {
+			if _, ok := overlaps[watched.Watcher]; ok {
+				continue
+			}
+			overlaps[watched.Watcher] = &actions.TriggeredLines{
+				DiffLines:    diffLines[i],
+				WatchedLines: watched.Lines,
+				Hunk:         fileDiff.Hunks[i],
 			}
 		}
+	}
+}
 
-		// Watch line occurs before diff range, so move on to the next watcher LineRange forward
-		watchIndex += 1
+// Checks if the watched lines, on the given side of the diff, overlap any lines written while resolving a merge conflict
+func findResolutionOverlap(mergeParent *MergeParent, watchedLines []actions.LineRange, fileDiff *diff.FileDiff, side string) *actions.TriggeredLines {
+	if mergeParent == nil {
+		return nil
 	}
+	resolutions := mergeParent.Resolutions
+	if side == models.NEW_SIDE {
+		resolutions = mergeParent.NewResolutions
+	}
+	if len(resolutions) == 0 {
+		return nil
+	}
+
+	// findOverlap pairs each line range with the hunk at the same index, so line the hunks up with the resolutions.
+	// Resolutions outside of every hunk have nothing to show for them, so they're left out.
+	var resolutionLines []actions.LineRange
+	resolutionDiff := &diff.FileDiff{}
+	for _, resolution := range resolutions {
+		for _, hunk := range fileDiff.Hunks {
+			start, lines := hunk.OrigStartLine, hunk.OrigLines
+			if side == models.NEW_SIDE {
+				start, lines = hunk.NewStartLine, hunk.NewLines
+			}
+			if int(start) <= resolution.StartLine && resolution.StartLine <= int(start+lines) {
+				resolutionLines = append(resolutionLines, resolution)
+				resolutionDiff.Hunks = append(resolutionDiff.Hunks, hunk)
+				break
+			}
+		}
+	}
+	return findOverlap(resolutionLines, watchedLines, resolutionDiff)
 }
 
 func renamed(fileDiff *diff.FileDiff) bool {
@@ -161,24 +648,65 @@ func modeChanged(fileDiff *diff.FileDiff) bool {
 	return false
 }
 
-func specialTrigger(w models.Watcher, changedLines []actions.LineRange, fileDiff *diff.FileDiff) (bool, string) {
-	if w.TriggerAny {
+// Describes the paths on both sides of the diff, for explaining the special triggers
+func pathChange(fileDiff *diff.FileDiff) string {
+	return fmt.Sprintf("%s -> %s", fileDiff.OrigName, fileDiff.NewName)
+}
+
+// Describes the file modes in the diff's extended headers, if it has any
+func modeChange(fileDiff *diff.FileDiff) string {
+	var oldMode, newMode string
+	for _, header := range fileDiff.Extended {
+		if strings.HasPrefix(header, "old mode ") {
+			oldMode = strings.TrimPrefix(header, "old mode ")
+		} else if strings.HasPrefix(header, "new mode ") {
+			newMode = strings.TrimPrefix(header, "new mode ")
+		}
+	}
+	if oldMode == "" && newMode == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s -> %s", oldMode, newMode)
+}
+
+// Describes the submodule commits, if the diff is for a submodule
+func submoduleCommits(submodule *actions.SubmoduleChange) string {
+	if submodule == nil {
+		return ""
+	}
+	return fmt.Sprintf("%s %s -> %s", submodule.Path, submodule.OldCommit, submodule.NewCommit)
+}
+
+// Checks the conditions a watcher can turn on to trigger on something other than its lines changing, in order,
+// returning the reason for the first one that's met. submodule and asset are the submodule and LFS pointer changes
+// parsed from the diff, if any.
+func specialTrigger(w models.Watcher, changedLines []actions.LineRange, fileDiff *diff.FileDiff, submodule *actions.SubmoduleChange, asset *actions.AssetChange, trace *Trace) (bool, string) {
+	if w.TriggerAny && trace.check("trigger_any", true, "") {
 		return true, "Any Change"
 	}
-	if w.TriggerAnyLine && len(changedLines) > 0 {
+	if w.TriggerAnyLine && trace.check("trigger_any_line", len(changedLines) > 0, fmt.Sprintf("%d changed ranges", len(changedLines))) {
 		return true, "Any Line"
 	}
-	if w.TriggerOnRename && renamed(fileDiff) {
+	if w.TriggerOnRename && trace.check("trigger_on_rename", renamed(fileDiff), pathChange(fileDiff)) {
 		return true, "File Renamed"
 	}
-	if w.TriggerOnMove && moved(fileDiff) {
+	if w.TriggerOnMove && trace.check("trigger_on_move", moved(fileDiff), pathChange(fileDiff)) {
 		return true, "File Moved"
 	}
-	if w.TriggerOnDelete && deleted(fileDiff) {
+	if w.TriggerOnDelete && trace.check("trigger_on_delete", deleted(fileDiff), pathChange(fileDiff)) {
 		return true, "File Deleted"
 	}
-	if w.TriggerOnMode && modeChanged(fileDiff) {
+	if w.TriggerOnMode && trace.check("trigger_on_mode", modeChanged(fileDiff), modeChange(fileDiff)) {
 		return true, "File Mode Changed"
 	}
+	if w.TriggerOnSubmodule && trace.check("trigger_on_submodule", submodule != nil, submoduleCommits(submodule)) {
+		return true, "Submodule Updated"
+	}
+	if w.TriggerOnAssetChange {
+		triggered, reason := assetReplaced(w, asset)
+		if trace.check("trigger_on_asset_change", triggered, reason) {
+			return true, reason
+		}
+	}
 	return false, ""
-}
\ No newline at end of file
+}
@@ -1,13 +1,26 @@
 package trigger
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/bennettaur/diffhook/services/diffhook/models"
 	"github.com/bennettaur/diffhook/services/diffhook/models/actions"
 	"github.com/sourcegraph/go-diff/diff"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
 )
 
 func Test_findOverlapOneEach(t *testing.T) {
@@ -484,28 +497,1588 @@ func TestGetActions(t *testing.T) {
 				"Any Line Log Watch",
 			},
 		},
+		{
+			name:           "watched lines changed without the required co-change",
+			watcherFixture: "../../../test/one_line.diff",
+			storeFixture:   "../../../test/cochange.diffhook.yml",
+			wantWatcherNames: []string{
+				"Docs Co-change Watch",
+				"Exact Co-change Watch",
+			},
+		},
+		{
+			name:             "watched lines changed with the required co-change",
+			watcherFixture:   "../../../test/cochange.diff",
+			storeFixture:     "../../../test/cochange.diffhook.yml",
+			wantWatcherNames: []string{"Exact Co-change Watch"},
+		},
+		{
+			name:             "submodule bumped",
+			watcherFixture:   "../../../test/submodule.diff",
+			storeFixture:     "../../../test/submodule.diffhook.yml",
+			wantWatcherNames: []string{"Submodule Watch"},
+		},
+		{
+			name:             "lfs asset replaced",
+			watcherFixture:   "../../../test/lfs.diff",
+			storeFixture:     "../../../test/lfs.diffhook.yml",
+			wantWatcherNames: []string{"Asset Watch", "Asset Growth Watch"},
+		},
+		{
+			name:             "lfs asset replaced without the sizes",
+			watcherFixture:   "../../../test/lfs_oid_only.diff",
+			storeFixture:     "../../../test/lfs.diffhook.yml",
+			wantWatcherNames: []string{"Asset Watch", "Asset Growth Watch", "Big Asset Growth Watch"},
+		},
+		{
+			name:             "combined diff from a merge commit",
+			watcherFixture:   "../../../test/merge.diff",
+			storeFixture:     "../../../test/merge.diffhook.yml",
+			wantWatcherNames: []string{"Resolution Watch", "Any Line Merge Watch"},
+		},
+		{
+			name:             "line ranges on the new side",
+			watcherFixture:   "../../../test/line_side.diff",
+			storeFixture:     "../../../test/line_side.diffhook.yml",
+			wantWatcherNames: []string{"Old Side Watch", "New Side Watch"},
+		},
+		{
+			// The co-change watchers are on src/main.go and require a change in the excluded and generated files
+			name:             "excluded and generated files",
+			watcherFixture:   "../../../test/exclude/exclude.diff",
+			storeFixture:     "../../../test/exclude/.diffhook.yml",
+			wantWatcherNames: []string{"Watch src/main.go", "Watch src/keep.pb.go"},
+		},
+		{
+			name:           "log with merge and regular commits",
+			watcherFixture: "../../../test/merge_log.diff",
+			storeFixture:   "../../../test/merge.diffhook.yml",
+			wantWatcherNames: []string{
+				"Resolution Watch",
+				"Any Line Merge Watch",
+				"Resolution Watch",
+				"Any Line Merge Watch",
+				"Resolution Watch",
+				"Feature Lines Watch",
+				"Any Line Merge Watch",
+			},
+		},
+		{
+			name:           "log with two merges changing the same lines",
+			watcherFixture: "../../../test/merge_log_two.diff",
+			storeFixture:   "../../../test/merge.diffhook.yml",
+			wantWatcherNames: []string{
+				"Resolution Watch",
+				"Any Line Merge Watch",
+				"Resolution Watch",
+				"Any Line Merge Watch",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			index := loadIndex(t, tt.storeFixture)
+			f, err := os.Open(tt.watcherFixture)
+			if err != nil {
+				t.Errorf("Error opening file: %s", err)
+				return
+			}
+			defer f.Close()
+			mr := NewDiffReader(f)
+			watchers := TriggerWatchers(context.Background(), index, mr).Triggered
+			var watcherNames []string
+			for _, w := range watchers {
+				watcherNames = append(watcherNames, w.Watcher.Name)
+			}
+
+			assert.ElementsMatch(t, tt.wantWatcherNames, watcherNames)
+		})
+	}
+}
+
+func loadIndex(t testing.TB, storeFile string) *Index {
+	store, err := models.GetLocalStore(storeFile)
+	require.Nil(t, err, "Error loading store: %s", err)
+	index, err := NewIndex(store)
+	require.Nil(t, err, "Error indexing store: %s", err)
+	return index
+}
+
+func TestNewIndexValidatesStore(t *testing.T) {
+	store := models.LocalStore{
+		Exclude: []string{"vendor/["},
+		Watchers: []models.Watcher{
+			{Name: "Valid Watch", FilePath: "a/test/testdiff.txt", Lines: []actions.LineRange{{StartLine: 1, EndLine: 2}}},
+			{FilePath: "a/test/testdiff.txt", Lines: []actions.LineRange{{StartLine: 5, EndLine: 3}}},
+			{Name: "Sideways Watch", FilePath: "a/test/testdiff.txt", LineSide: "left"},
+			{Name: "Commit Watch", FilePath: "a/test/testdiff.txt", Commit: &models.CommitConditions{ExceptMessage: "PROJ-("}},
+		},
+		Freezes: []models.Freeze{
+			{Start: "2021-12-20", End: "2022-01-03", Timezone: "Mars/Olympus_Mons", Paths: []string{"src/**"}},
+		},
+	}
+	data, err := yaml.Marshal(store)
+	require.Nil(t, err, "Error marshaling store: %s", err)
+	storeFile := filepath.Join(t.TempDir(), ".diffhook.yml")
+	require.Nil(t, ioutil.WriteFile(storeFile, data, 0644))
+
+	loaded, err := models.GetLocalStore(storeFile)
+	require.Nil(t, err, "Error loading store: %s", err)
+	_, err = NewIndex(loaded)
+	require.NotNil(t, err)
+	assert.Equal(t, fmt.Sprintf(`can't load watchers from %s: invalid watchers:
+  exclude "vendor/[" isn't a valid glob
+  watcher 2 (): missing name, invalid line range L5 - L3
+  watcher 3 (Sideways Watch): line_side must be old or new, got left
+  watcher 4 (Commit Watch): commit condition "PROJ-(" isn't a valid regular expression: error parsing regexp: missing closing ): `+"`PROJ-(`"+`
+  freeze 1 (): missing name, unknown timezone Mars/Olympus_Mons`, storeFile), err.Error())
+}
+
+func TestStreamWatchers(t *testing.T) {
+	index := loadIndex(t, "../../../test/.diffhook.yml")
+
+	tests := []struct {
+		name      string
+		stopAfter int
+		wantCalls int
+	}{
+		{name: "reads the whole diff", stopAfter: 10, wantCalls: 4},
+		{name: "stops early", stopAfter: 1, wantCalls: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := os.Open("../../../test/multiple.diff")
+			require.Nil(t, err, "Error opening file: %s", err)
+			defer f.Close()
+
+			calls := 0
+			StreamWatchers(context.Background(), index, NewDiffReader(f), func(tw TriggeredWatcher) bool {
+				calls++
+				return calls < tt.stopAfter
+			})
+			assert.Equal(t, tt.wantCalls, calls)
+		})
+	}
+}
+
+type errSource struct{}
+
+func (errSource) Old(*diff.FileDiff) ([]byte, error) {
+	return nil, errors.New("no such blob")
+}
+
+func (errSource) New(*diff.FileDiff) ([]byte, error) {
+	return nil, errors.New("no such blob")
+}
+
+// Fails every read, like a diff piped from a process that died
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) {
+	return 0, errors.New("broken pipe")
+}
+
+// Returns the same error without ever getting any further through the diff
+type stuckReader struct {
+	err error
+}
+
+func (r stuckReader) ReadFile() (*diff.FileDiff, error) {
+	return nil, r.err
+}
+
+func TestTriggerWatchersReportsErrors(t *testing.T) {
+	t.Run("unparseable file", func(t *testing.T) {
+		f, err := os.Open("../../../test/corrupt.diff")
+		require.Nil(t, err, "Error opening file: %s", err)
+		defer f.Close()
+
+		result := TriggerWatchers(context.Background(), loadIndex(t, "../../../test/.diffhook.yml"), NewDiffReader(f))
+		require.Len(t, result.Errors, 1)
+		var parseErr *ParseError
+		require.True(t, errors.As(result.Errors[0], &parseErr))
+		assert.Equal(t, 0, parseErr.File)
+		// The rest of the diff is still evaluated
+		assert.NotEmpty(t, result.Triggered)
+	})
+
+	t.Run("unreadable diff", func(t *testing.T) {
+		for name, reader := range map[string]FileDiffReader{
+			"plain":    NewDiffReader(failingReader{}),
+			"combined": NewCombinedDiffReader(failingReader{}),
+			"stuck":    stuckReader{err: errors.New("broken pipe")},
+		} {
+			t.Run(name, func(t *testing.T) {
+				result := TriggerWatchers(context.Background(), loadIndex(t, "../../../test/.diffhook.yml"), reader)
+				require.Len(t, result.Errors, 1)
+				var parseErr *ParseError
+				require.True(t, errors.As(result.Errors[0], &parseErr))
+				assert.EqualError(t, parseErr.Err, "broken pipe")
+				assert.Empty(t, result.Triggered)
+			})
+		}
+	})
+
+	t.Run("unreadable fingerprinted file", func(t *testing.T) {
+		lines := actions.LineRange{StartLine: 20, EndLine: 22}
+		index, err := NewIndex(&models.LocalStore{Watchers: []models.Watcher{{
+			Name:         "Fingerprinted Watch",
+			FilePath:     "a/test/testdiff.txt",
+			Lines:        []actions.LineRange{lines},
+			Fingerprints: []models.Fingerprint{{Lines: lines, Hash: "stale"}},
+			Actions:      &actions.Actions{},
+		}}})
+		require.Nil(t, err, "Error indexing store: %s", err)
+
+		f, err := os.Open("../../../test/one_line.diff")
+		require.Nil(t, err, "Error opening file: %s", err)
+		defer f.Close()
+
+		result := TriggerWatchers(context.Background(), index.WithSource(errSource{}), NewDiffReader(f))
+		require.Len(t, result.Errors, 1)
+		var watcherErr *WatcherError
+		require.True(t, errors.As(result.Errors[0], &watcherErr))
+		assert.Equal(t, "Fingerprinted Watch", watcherErr.Watcher)
+		// The lines as configured are still checked
+		require.Len(t, result.Triggered, 1)
+	})
+
+	t.Run("missing store", func(t *testing.T) {
+		models.SetLocalStore(filepath.Join(t.TempDir(), ".diffhook.yml"))
+		defer models.SetLocalStore(models.DefaultFileStore)
+
+		_, err := LoadIndex()
+		var storeErr *StoreError
+		require.True(t, errors.As(err, &storeErr))
+		assert.True(t, os.IsNotExist(errors.Unwrap(storeErr)))
+	})
+}
+
+func TestStreamWatchersCancelled(t *testing.T) {
+	f, err := os.Open("../../../test/multiple.diff")
+	require.Nil(t, err, "Error opening file: %s", err)
+	defer f.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	result := TriggerWatchers(ctx, loadIndex(t, "../../../test/.diffhook.yml"), NewDiffReader(f))
+	assert.Empty(t, result.Triggered)
+	require.Len(t, result.Errors, 1)
+	assert.True(t, errors.Is(result.Errors[0], context.Canceled))
+}
+
+func TestTriggerWatchersNewPath(t *testing.T) {
+	index, err := NewIndex(&models.LocalStore{Watchers: []models.Watcher{
+		{Name: "New File Watch", FilePath: "a/src/new.go", LineSide: models.NEW_SIDE, Lines: []actions.LineRange{{StartLine: 1, EndLine: 5}}},
+		{Name: "Old Side New File Watch", FilePath: "a/src/new.go", TriggerAny: true},
+		{Name: "Renamed File Watch", FilePath: "a/test/testdiff2.txt", LineSide: models.NEW_SIDE, TriggerAny: true},
+		{Name: "Old Side Renamed File Watch", FilePath: "a/test/testdiff2.txt", TriggerAny: true},
+	}})
+	require.Nil(t, err, "Error indexing store: %s", err)
+
+	added := `diff --git a/src/new.go b/src/new.go
+new file mode 100644
+index 0000000..3b18e51
+--- /dev/null
++++ b/src/new.go
+@@ -0,0 +1,5 @@
++package src
++
++func New() string {
++	return "new"
++}
+`
+	renamed, err := ioutil.ReadFile("../../../test/rename.diff")
+	require.Nil(t, err, "Error reading fixture: %s", err)
+
+	tests := []struct {
+		name             string
+		diff             string
+		wantWatcherNames []string
+	}{
+		{name: "file added", diff: added, wantWatcherNames: []string{"New File Watch"}},
+		{name: "file renamed", diff: string(renamed), wantWatcherNames: []string{"Renamed File Watch"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var watcherNames []string
+			for _, tw := range TriggerWatchers(context.Background(), index, NewDiffReader(strings.NewReader(tt.diff))).Triggered {
+				watcherNames = append(watcherNames, tw.Watcher.Name)
+			}
+			assert.Equal(t, tt.wantWatcherNames, watcherNames)
+		})
+	}
+}
+
+func TestTriggerWatchersTrace(t *testing.T) {
+	store, err := models.GetLocalStore("../../../test/cochange.diffhook.yml")
+	require.Nil(t, err, "Error loading store: %s", err)
+	store.Watchers = append(store.Watchers, models.Watcher{Name: "Missing File Watch", FilePath: "a/missing.txt", TriggerAny: true})
+	index, err := NewIndex(store)
+	require.Nil(t, err, "Error indexing store: %s", err)
+
+	f, err := os.Open("../../../test/cochange.diff")
+	require.Nil(t, err, "Error opening file: %s", err)
+	defer f.Close()
+
+	trace := &Trace{}
+	TriggerWatchers(WithTrace(context.Background(), trace), index, NewDiffReader(f))
+
+	tests := []struct {
+		watcher       string
+		wantTriggered bool
+		wantReason    string
+		wantChecks    []string
+	}{
+		{
+			watcher:    "Docs Co-change Watch",
+			wantReason: "Changed along with docs/**/*.md",
+			wantChecks: []string{"changed_lines", "watched_lines", "watched_lines_changed", "requires_change_in"},
+		},
+		{
+			watcher:       "Exact Co-change Watch",
+			wantTriggered: true,
+			wantReason:    "Any Change without a change in test/othertest/testdiff.txt",
+			wantChecks:    []string{"changed_lines", "watched_lines", "trigger_any", "requires_change_in"},
+		},
+		{
+			watcher:    "Missing File Watch",
+			wantReason: "None of the 2 files in the diff are a/missing.txt",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.watcher, func(t *testing.T) {
+			explanations := trace.Filter(tt.watcher)
+			require.Len(t, explanations, 1)
+			assert.Equal(t, tt.wantTriggered, explanations[0].Triggered)
+			assert.Equal(t, tt.wantReason, explanations[0].Reason)
+
+			var checks []string
+			for _, check := range explanations[0].Checks {
+				checks = append(checks, check.Condition)
+			}
+			assert.Equal(t, tt.wantChecks, checks)
+		})
+	}
+}
+
+func TestTriggerWatchersTraceDetails(t *testing.T) {
+	skipAll := &Change{Commits: []*actions.Commit{actions.NewCommit("aaa", "A <a@example.com>", "A <a@example.com>", "Sweep headers [skip diffhook]")}}
+
+	tests := []struct {
+		name          string
+		fixture       string
+		watcher       models.Watcher
+		change        *Change
+		condition     string
+		wantDetail    string
+		wantTriggered bool
+		wantReason    string
+	}{
+		{
+			name:          "rename",
+			fixture:       "rename.diff",
+			watcher:       models.Watcher{FilePath: "a/test/testdiff.txt", TriggerOnRename: true},
+			condition:     "trigger_on_rename",
+			wantDetail:    "a/test/testdiff.txt -> b/test/testdiff2.txt",
+			wantTriggered: true,
+			wantReason:    "File Renamed",
+		},
+		{
+			name:          "move",
+			fixture:       "move.diff",
+			watcher:       models.Watcher{FilePath: "a/test/testdiff.txt", TriggerOnMove: true},
+			condition:     "trigger_on_move",
+			wantDetail:    "a/test/testdiff.txt -> b/test/othertest/testdiff.txt",
+			wantTriggered: true,
+			wantReason:    "File Moved",
+		},
+		{
+			name:          "delete",
+			fixture:       "delete.diff",
+			watcher:       models.Watcher{FilePath: "a/test/testdiff.txt", TriggerOnDelete: true},
+			condition:     "trigger_on_delete",
+			wantDetail:    "a/test/testdiff.txt -> /dev/null",
+			wantTriggered: true,
+			wantReason:    "File Deleted",
+		},
+		{
+			name:          "submodule",
+			fixture:       "submodule.diff",
+			watcher:       models.Watcher{FilePath: "a/vendor/lib", TriggerOnSubmodule: true},
+			condition:     "trigger_on_submodule",
+			wantDetail:    "vendor/lib 1f3c2a1d7e1c5b0a8f1e2d3c4b5a69788796a5b4 -> 9b8e7d6c5b4a39281706f5e4d3c2b1a098877665",
+			wantTriggered: true,
+			wantReason:    "Submodule Updated",
+		},
+		{
+			name:       "skipped",
+			fixture:    "one_line.diff",
+			watcher:    models.Watcher{FilePath: "a/test/testdiff.txt", TriggerAny: true},
+			change:     skipAll,
+			condition:  "skip",
+			wantDetail: "skipped by A <a@example.com> in commit aaa (all)",
+			wantReason: "Any Change, but skipped by A <a@example.com> in commit aaa (all)",
+		},
+		{
+			name:       "skipped without a required change",
+			fixture:    "one_line.diff",
+			watcher:    models.Watcher{FilePath: "a/test/testdiff.txt", TriggerAny: true, RequiresChangeIn: []string{"docs/**"}},
+			change:     skipAll,
+			condition:  "requires_change_in",
+			wantDetail: "a change in docs/**",
+			wantReason: "Any Change without a change in docs/**, but skipped by A <a@example.com> in commit aaa (all)",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			watcher := tt.watcher
+			watcher.Name = "Traced Watch"
+			index, err := NewIndex(&models.LocalStore{Watchers: []models.Watcher{watcher}})
+			require.Nil(t, err, "Error indexing store: %s", err)
+
+			f, err := os.Open("../../../test/" + tt.fixture)
+			require.Nil(t, err, "Error opening file: %s", err)
+			defer f.Close()
+
+			trace := &Trace{}
+			TriggerWatchers(WithTrace(WithChange(context.Background(), tt.change), trace), index, NewDiffReader(f))
+
+			explanations := trace.Filter(watcher.Name)
+			require.Len(t, explanations, 1)
+			assert.Equal(t, tt.wantTriggered, explanations[0].Triggered)
+			assert.Equal(t, tt.wantReason, explanations[0].Reason)
+
+			var details []string
+			for _, check := range explanations[0].Checks {
+				if check.Condition == tt.condition {
+					details = append(details, check.Detail)
+				}
+			}
+			assert.Equal(t, []string{tt.wantDetail}, details)
+		})
+	}
+}
+
+func TestTriggerWatchersCommitConditions(t *testing.T) {
+	bot := actions.NewCommit("aaa", "renovate[bot] <bot@renovateapp.com>", "GitHub <noreply@github.com>", "Update deps")
+	person := actions.NewCommit("bbb", "Alice <alice@example.com>", "Alice <alice@example.com>", "PROJ-12 Fix the thing\n\nSecurity-Review: bob")
+	unreviewed := actions.NewCommit("ccc", "Alice <alice@example.com>", "Alice <alice@example.com>", "Fix the other thing")
+
+	tests := []struct {
+		name          string
+		conditions    models.CommitConditions
+		commits       []*actions.Commit
+		wantTriggered bool
+		wantErr       bool
+	}{
+		{
+			name:       "excluded author",
+			conditions: models.CommitConditions{ExceptAuthors: []string{"renovate*"}},
+			commits:    []*actions.Commit{bot},
+		},
+		{
+			name:          "any commit can match",
+			conditions:    models.CommitConditions{ExceptAuthors: []string{"renovate*"}},
+			commits:       []*actions.Commit{bot, person},
+			wantTriggered: true,
+		},
+		{
+			name:          "author email",
+			conditions:    models.CommitConditions{Authors: []string{"*@example.com"}},
+			commits:       []*actions.Commit{person},
+			wantTriggered: true,
+		},
+		{
+			name:       "committer",
+			conditions: models.CommitConditions{Committers: []string{"Alice"}},
+			commits:    []*actions.Commit{bot},
+		},
+		{
+			name:          "message without a ticket",
+			conditions:    models.CommitConditions{ExceptMessage: `[A-Z]+-\d+`},
+			commits:       []*actions.Commit{unreviewed},
+			wantTriggered: true,
+		},
+		{
+			name:       "message with a ticket",
+			conditions: models.CommitConditions{ExceptMessage: `[A-Z]+-\d+`},
+			commits:    []*actions.Commit{person},
+		},
+		{
+			name:          "missing trailer",
+			conditions:    models.CommitConditions{MissingTrailers: []string{"security-review"}},
+			commits:       []*actions.Commit{unreviewed},
+			wantTriggered: true,
+		},
+		{
+			name:       "has trailer",
+			conditions: models.CommitConditions{MissingTrailers: []string{"Security-Review"}},
+			commits:    []*actions.Commit{person},
+		},
+		{
+			name:          "no commits",
+			conditions:    models.CommitConditions{Authors: []string{"Alice"}},
+			wantTriggered: true,
+			wantErr:       true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conditions := tt.conditions
+			index, err := NewIndex(&models.LocalStore{Watchers: []models.Watcher{
+				{Name: "Commit Watch", FilePath: "a/test/testdiff.txt", TriggerAny: true, Commit: &conditions},
+			}})
+			require.Nil(t, err, "Error indexing store: %s", err)
+
+			f, err := os.Open("../../../test/one_line.diff")
+			require.Nil(t, err, "Error opening file: %s", err)
+			defer f.Close()
+
+			ctx := context.Background()
+			if tt.commits != nil {
+				ctx = WithChange(ctx, &Change{Commits: tt.commits})
+			}
+			result := TriggerWatchers(ctx, index, NewDiffReader(f))
+			assert.Equal(t, tt.wantTriggered, len(result.Triggered) > 0)
+			assert.Equal(t, tt.wantErr, len(result.Errors) > 0)
+		})
+	}
+}
+
+func TestTriggerWatchersBranchFilters(t *testing.T) {
+	var store models.LocalStore
+	err := yaml.Unmarshal([]byte(`
+watchers:
+  - name: Release Watch
+    file_path: a/test/testdiff.txt
+    trigger_any: true
+    only_on:
+      target: [main, release/*]
+    except:
+      source: [dependabot/**]
+    actions:
+      - type: log
+        message: Released
+        only_on:
+          target: [main]
+`), &store)
+	require.Nil(t, err, "Error parsing store: %s", err)
+	index, err := NewIndex(&store)
+	require.Nil(t, err, "Error indexing store: %s", err)
+
+	allowed, _ := (*store.Watchers[0].Actions)[0].ActionBranchFilters().Allows(&actions.Branches{Target: "release/2.0"})
+	assert.False(t, allowed, "action should only run on main")
+
+	tests := []struct {
+		name          string
+		branches      *actions.Branches
+		wantTriggered bool
+	}{
+		{name: "into main", branches: &actions.Branches{Target: "main", Source: "feature"}, wantTriggered: true},
+		{name: "into a release", branches: &actions.Branches{Target: "release/2.0", Source: "fix"}, wantTriggered: true},
+		{name: "into develop", branches: &actions.Branches{Target: "develop", Source: "feature"}},
+		{name: "from dependabot", branches: &actions.Branches{Target: "main", Source: "dependabot/go/yaml"}},
+		{name: "unknown branches"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := os.Open("../../../test/one_line.diff")
+			require.Nil(t, err, "Error opening file: %s", err)
+			defer f.Close()
+
+			ctx := WithChange(context.Background(), &Change{Branches: tt.branches})
+			result := TriggerWatchers(ctx, index, NewDiffReader(f))
+			assert.Equal(t, tt.wantTriggered, len(result.Triggered) > 0)
+		})
+	}
+}
+
+func TestTriggerWatchersSkipDirectives(t *testing.T) {
+	index, err := NewIndex(&models.LocalStore{Watchers: []models.Watcher{
+		{Name: "Header Watch", FilePath: "a/test/testdiff.txt", Tags: []string{"licensing"}, TriggerAny: true},
+		{Name: "Other Watch", FilePath: "a/test/testdiff.txt", TriggerAny: true},
+	}})
+	require.Nil(t, err, "Error indexing store: %s", err)
+
+	tests := []struct {
+		name        string
+		change      *Change
+		wantSkipped map[string]string
+	}{
+		{
+			name:   "no directives",
+			change: &Change{Commits: []*actions.Commit{actions.NewCommit("aaa", "A <a@example.com>", "A <a@example.com>", "Fix")}},
+		},
+		{
+			name:   "skip marker",
+			change: &Change{Commits: []*actions.Commit{actions.NewCommit("aaa", "A <a@example.com>", "A <a@example.com>", "Sweep headers [skip diffhook]")}},
+			wantSkipped: map[string]string{
+				"Header Watch": "skipped by A <a@example.com> in commit aaa (all)",
+				"Other Watch":  "skipped by A <a@example.com> in commit aaa (all)",
+			},
+		},
+		{
+			name:   "trailer with a tag",
+			change: &Change{Commits: []*actions.Commit{actions.NewCommit("aaa", "A <a@example.com>", "A <a@example.com>", "Sweep headers\n\ndiffhook-skip: licensing")}},
+			wantSkipped: map[string]string{
+				"Header Watch": "skipped by A <a@example.com> in commit aaa (licensing)",
+			},
+		},
+		{
+			name: "range with a skipped commit",
+			change: &Change{Commits: []*actions.Commit{
+				actions.NewCommit("aaa", "A <a@example.com>", "A <a@example.com>", "Sweep headers [skip diffhook]"),
+				actions.NewCommit("bbb", "B <b@example.com>", "B <b@example.com>", "Fix the thing"),
+			}},
+		},
+		{
+			name: "range with every commit skipped",
+			change: &Change{Commits: []*actions.Commit{
+				actions.NewCommit("aaa", "A <a@example.com>", "A <a@example.com>", "Sweep headers [skip diffhook]\n\nDiffhook-Skip: licensing"),
+				actions.NewCommit("bbb", "B <b@example.com>", "B <b@example.com>", "Sweep more headers\n\nDiffhook-Skip: Licensing"),
+			}},
+			wantSkipped: map[string]string{
+				"Header Watch": "skipped by A <a@example.com>, B <b@example.com> in all 2 commits (licensing)",
+			},
+		},
+		{
+			name:   "pull request description",
+			change: &Change{PullRequest: &PullRequest{Author: "bob", Body: "Renames things\n\nDiffhook-Skip: Other Watch, unknown"}},
+			wantSkipped: map[string]string{
+				"Other Watch": "skipped by bob in the pull request description (Other Watch)",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := os.Open("../../../test/one_line.diff")
+			require.Nil(t, err, "Error opening file: %s", err)
+			defer f.Close()
+
+			result := TriggerWatchers(WithChange(context.Background(), tt.change), index, NewDiffReader(f))
+			skipped := make(map[string]string)
+			for _, tw := range result.Skipped {
+				skipped[tw.Watcher.Name] = tw.Skip.String()
+			}
+			if tt.wantSkipped == nil {
+				tt.wantSkipped = map[string]string{}
+			}
+			assert.Equal(t, tt.wantSkipped, skipped)
+			assert.Len(t, result.Triggered, 2-len(skipped))
+		})
+	}
+}
+
+func TestTriggerWatchersActiveWindow(t *testing.T) {
+	change := &Change{Clock: func() time.Time { return time.Date(2021, 6, 15, 12, 0, 0, 0, time.UTC) }}
+
+	tests := []struct {
+		name          string
+		watcher       models.Watcher
+		wantTriggered bool
+	}{
+		{name: "always active", wantTriggered: true},
+		{name: "not active yet", watcher: models.Watcher{ActiveFrom: "2021-07-01"}},
+		{name: "active window", watcher: models.Watcher{ActiveFrom: "2021-06-01", ActiveUntil: "2021-06-30"}, wantTriggered: true},
+		{name: "last day of the window", watcher: models.Watcher{ActiveUntil: "2021-06-15"}, wantTriggered: true},
+		{name: "window over", watcher: models.Watcher{ActiveUntil: "2021-06-14"}},
+		{name: "snoozed", watcher: models.Watcher{SnoozedUntil: "2021-06-15T13:00:00Z"}},
+		{name: "snooze over", watcher: models.Watcher{SnoozedUntil: "2021-06-15T11:00:00Z"}, wantTriggered: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			watcher := tt.watcher
+			watcher.Name = "Timed Watch"
+			watcher.FilePath = "a/test/testdiff.txt"
+			watcher.TriggerAny = true
+			index, err := NewIndex(&models.LocalStore{Watchers: []models.Watcher{watcher}})
+			require.Nil(t, err, "Error indexing store: %s", err)
+
+			f, err := os.Open("../../../test/one_line.diff")
+			require.Nil(t, err, "Error opening file: %s", err)
+			defer f.Close()
+
+			result := TriggerWatchers(WithChange(context.Background(), change), index, NewDiffReader(f))
+			assert.Equal(t, tt.wantTriggered, len(result.Triggered) > 0)
+		})
+	}
+}
+
+func TestTriggerWatchersFreezes(t *testing.T) {
+	freeze := models.Freeze{
+		Name:     "Holiday Freeze",
+		Start:    "2021-12-20T17:00",
+		End:      "2022-01-03",
+		Timezone: "America/Toronto",
+		Paths:    []string{"test/**"},
+	}
+
+	tests := []struct {
+		name    string
+		except  []string
+		exclude []string
+		// fixture defaults to one_line.diff
+		fixture string
+		// message is the commit message, for skip directives
+		message     string
+		now         time.Time
+		wantReason  string
+		wantSkipped bool
+	}{
+		{
+			name:       "during the freeze",
+			now:        time.Date(2021, 12, 25, 12, 0, 0, 0, time.UTC),
+			wantReason: "Change during freeze Holiday Freeze",
+		},
+		{
+			name: "before it starts in its timezone",
+			now:  time.Date(2021, 12, 20, 21, 0, 0, 0, time.UTC),
+		},
+		{
+			name:       "after it starts in its timezone",
+			now:        time.Date(2021, 12, 20, 23, 0, 0, 0, time.UTC),
+			wantReason: "Change during freeze Holiday Freeze",
+		},
+		{
+			name:       "last day",
+			now:        time.Date(2022, 1, 4, 3, 0, 0, 0, time.UTC),
+			wantReason: "Change during freeze Holiday Freeze",
+		},
+		{
+			name: "after it ends",
+			now:  time.Date(2022, 1, 4, 6, 0, 0, 0, time.UTC),
+		},
+		{
+			name:   "excepted path",
+			except: []string{"test/*.txt"},
+			now:    time.Date(2021, 12, 25, 12, 0, 0, 0, time.UTC),
+		},
+		{
+			name:       "excluded path",
+			exclude:    []string{"test/**"},
+			now:        time.Date(2021, 12, 25, 12, 0, 0, 0, time.UTC),
+			wantReason: "Change during freeze Holiday Freeze",
+		},
+		{
+			name:       "merge with a diff per parent",
+			fixture:    "../../../test/merge.diff",
+			now:        time.Date(2021, 12, 25, 12, 0, 0, 0, time.UTC),
+			wantReason: "Change during freeze Holiday Freeze",
+		},
+		{
+			name:       "skip marker doesn't skip freezes",
+			message:    "Sweep headers [skip diffhook]\n\nDiffhook-Skip: all",
+			now:        time.Date(2021, 12, 25, 12, 0, 0, 0, time.UTC),
+			wantReason: "Change during freeze Holiday Freeze",
+		},
+		{
+			name:        "skipped by name",
+			message:     "Hotfix\n\nDiffhook-Skip: holiday freeze",
+			now:         time.Date(2021, 12, 25, 12, 0, 0, 0, time.UTC),
+			wantSkipped: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			freeze := freeze
+			freeze.Except = tt.except
+			index, err := NewIndex(&models.LocalStore{Exclude: tt.exclude, Freezes: []models.Freeze{freeze}})
+			require.Nil(t, err, "Error indexing store: %s", err)
+
+			fixture := tt.fixture
+			if fixture == "" {
+				fixture = "../../../test/one_line.diff"
+			}
+			f, err := os.Open(fixture)
+			require.Nil(t, err, "Error opening file: %s", err)
+			defer f.Close()
+
+			now := tt.now
+			change := &Change{Clock: func() time.Time { return now }}
+			if tt.message != "" {
+				change.Commits = []*actions.Commit{actions.NewCommit("aaa", "A <a@example.com>", "A <a@example.com>", tt.message)}
+			}
+			result := TriggerWatchers(WithChange(context.Background(), change), index, NewDiffReader(f))
+			if tt.wantSkipped {
+				assert.Empty(t, result.Triggered)
+				assert.Len(t, result.Skipped, 1)
+				return
+			}
+			assert.Empty(t, result.Skipped)
+			if tt.wantReason == "" {
+				assert.Empty(t, result.Triggered)
+				return
+			}
+			require.Len(t, result.Triggered, 1)
+			assert.Equal(t, tt.wantReason, result.Triggered[0].Reason)
+			assert.Equal(t, "a/test/testdiff.txt", result.Triggered[0].Watcher.FilePath)
+			assert.Equal(t, models.SEVERITY_ERROR, result.Triggered[0].Watcher.SeverityLevel())
+		})
+	}
+}
+
+func TestTriggeredWatcher_ContentHash(t *testing.T) {
+	data, err := ioutil.ReadFile("../../../test/one_line.diff")
+	require.Nil(t, err, "Error reading file: %s", err)
+	fileDiff := func(edit func(*diff.FileDiff)) *TriggeredWatcher {
+		d, err := diff.ParseFileDiff(data)
+		require.Nil(t, err, "Error parsing diff: %s", err)
+		edit(d)
+		return &TriggeredWatcher{FileDiff: d, Reason: "Any Change"}
+	}
+
+	original := fileDiff(func(*diff.FileDiff) {}).ContentHash()
+	tests := []struct {
+		name     string
+		edit     func(*diff.FileDiff)
+		wantSame bool
+	}{
+		{
+			name: "moved down the file",
+			edit: func(d *diff.FileDiff) {
+				d.Hunks[0].OrigStartLine += 10
+				d.Hunks[0].NewStartLine += 10
+			},
+			wantSame: true,
+		},
+		{
+			name: "different change",
+			edit: func(d *diff.FileDiff) {
+				d.Hunks[0].Body = append(append([]byte{}, d.Hunks[0].Body...), []byte("+another line\n")...)
+			},
+		},
+		{
+			name: "different file",
+			edit: func(d *diff.FileDiff) {
+				d.NewName = "b/test/other.txt"
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := fileDiff(tt.edit).ContentHash()
+			assert.Equal(t, tt.wantSame, got == original)
+		})
+	}
+}
+
+func TestTriggeredWatcher_ContentHashOverlappingHunks(t *testing.T) {
+	var diffText bytes.Buffer
+	diffText.WriteString("--- a/test/testdiff.txt\n+++ b/test/testdiff.txt\n")
+	for _, start := range []int{1, 11, 31} {
+		fmt.Fprintf(&diffText, "@@ -%d,7 +%d,7 @@\n line\n line\n line\n-old %d\n+new %d\n line\n line\n line\n", start, start, start+3, start+3)
+	}
+	watcher := func(edit func(*diff.FileDiff)) *TriggeredWatcher {
+		d, err := diff.ParseFileDiff(diffText.Bytes())
+		require.Nil(t, err, "Error parsing diff: %s", err)
+		edit(d)
+		return &TriggeredWatcher{
+			FileDiff: d,
+			Reason:   "Watched lines changed",
+			// The watched lines are changed by the first two hunks
+			TriggeredLines: &actions.TriggeredLines{
+				WatchedLines: actions.LineRange{StartLine: 4, EndLine: 14},
+				Hunk:         d.Hunks[0],
+				Side:         models.OLD_SIDE,
+			},
+		}
+	}
+
+	original := watcher(func(*diff.FileDiff) {}).ContentHash()
+	tests := []struct {
+		name     string
+		hunk     int
+		wantSame bool
+	}{
+		{name: "triggering hunk changed", hunk: 0},
+		{name: "other overlapping hunk changed", hunk: 1},
+		{name: "hunk outside the watched lines changed", hunk: 2, wantSame: true},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			models.SetLocalStore(tt.storeFixture)
-			f, err := os.Open(tt.watcherFixture)
-			if err != nil {
-				t.Errorf("Error opening file: %s", err)
-				return
+			got := watcher(func(d *diff.FileDiff) {
+				d.Hunks[tt.hunk].Body = append(append([]byte{}, d.Hunks[tt.hunk].Body...), []byte("+another line\n")...)
+			}).ContentHash()
+			assert.Equal(t, tt.wantSame, got == original)
+		})
+	}
+}
+
+func TestTriggerWatchersMergeConflictResolution(t *testing.T) {
+	index := loadIndex(t, "../../../test/merge.diffhook.yml")
+	f, err := os.Open("../../../test/merge.diff")
+	require.Nil(t, err, "Error opening file: %s", err)
+	defer f.Close()
+
+	reasons := make(map[string]string)
+	for _, tw := range TriggerWatchers(context.Background(), index, NewDiffReader(f)).Triggered {
+		reasons[tw.Watcher.Name] = tw.Reason
+	}
+
+	assert.Equal(t, map[string]string{
+		"Resolution Watch":     "Merge Conflict Resolution",
+		"Any Line Merge Watch": "Any Line",
+	}, reasons)
+}
+
+func TestCombinedDiffReaderModeOnlyMerge(t *testing.T) {
+	f, err := os.Open("../../../test/merge_mode.diff")
+	require.Nil(t, err, "Error opening file: %s", err)
+	defer f.Close()
+
+	reader := NewDiffReader(f).(*CombinedDiffReader)
+	var names []string
+	var modeDiff *diff.FileDiff
+	var mergeParent *MergeParent
+	for {
+		fileDiff, err := reader.ReadFile()
+		if err == io.EOF {
+			break
+		}
+		require.Nil(t, err, "Error reading diff: %s", err)
+		names = append(names, fileDiff.NewName)
+		if fileDiff.NewName == "b/script.sh" {
+			modeDiff, mergeParent = fileDiff, reader.MergeParent(fileDiff)
+		}
+	}
+
+	// The other file has a diff per parent, and the mode change made while merging has no hunks to split
+	assert.Equal(t, []string{"b/other.txt", "b/other.txt", "b/script.sh"}, names)
+	require.NotNil(t, modeDiff)
+	assert.Equal(t, "a/script.sh", modeDiff.OrigName)
+	assert.Empty(t, modeDiff.Hunks)
+	assert.Equal(t, []string{"diff --cc script.sh", "index f79db40..5b607ce", "old mode 100644", "new mode 100755"}, modeDiff.Extended)
+	assert.Equal(t, &MergeParent{Parent: 1, Parents: 2, Commit: "3d2b00b451e817e793b1f0027d0701589ff148e8"}, mergeParent)
+}
+
+func Test_findResolutionOverlap(t *testing.T) {
+	hunk := &diff.Hunk{OrigStartLine: 19, OrigLines: 7, NewStartLine: 19, NewLines: 7}
+	fileDiff := &diff.FileDiff{Hunks: []*diff.Hunk{hunk}}
+
+	tests := []struct {
+		name        string
+		resolutions []actions.LineRange
+		want        *actions.TriggeredLines
+	}{
+		{
+			name:        "resolution in a hunk",
+			resolutions: []actions.LineRange{{StartLine: 22, EndLine: 22}},
+			want: &actions.TriggeredLines{
+				DiffLines:    actions.LineRange{StartLine: 22, EndLine: 22},
+				WatchedLines: actions.LineRange{StartLine: 20, EndLine: 30},
+				Hunk:         hunk,
+			},
+		},
+		{
+			name:        "resolution outside every hunk",
+			resolutions: []actions.LineRange{{StartLine: 28, EndLine: 28}},
+		},
+		{
+			name:        "resolution outside every hunk before one in a hunk",
+			resolutions: []actions.LineRange{{StartLine: 2, EndLine: 2}, {StartLine: 22, EndLine: 22}},
+			want: &actions.TriggeredLines{
+				DiffLines:    actions.LineRange{StartLine: 22, EndLine: 22},
+				WatchedLines: actions.LineRange{StartLine: 20, EndLine: 30},
+				Hunk:         hunk,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mergeParent := &MergeParent{Parent: 1, Parents: 2, Resolutions: tt.resolutions}
+			watched := []actions.LineRange{{StartLine: 1, EndLine: 1}, {StartLine: 20, EndLine: 30}}
+			assert.Equal(t, tt.want, findResolutionOverlap(mergeParent, watched, fileDiff, models.OLD_SIDE))
+		})
+	}
+}
+
+func TestTriggerWatchersLineSide(t *testing.T) {
+	index := loadIndex(t, "../../../test/line_side.diffhook.yml")
+	f, err := os.Open("../../../test/line_side.diff")
+	require.Nil(t, err, "Error opening file: %s", err)
+	defer f.Close()
+
+	lines := make(map[string]*actions.TriggeredLines)
+	for _, tw := range TriggerWatchers(context.Background(), index, NewDiffReader(f)).Triggered {
+		lines[tw.Watcher.Name] = tw.TriggeredLines
+	}
+
+	require.Len(t, lines, 2)
+	assert.Equal(t, models.OLD_SIDE, lines["Old Side Watch"].Side)
+	assert.Equal(t, actions.LineRange{StartLine: 40, EndLine: 41}, lines["Old Side Watch"].DiffLines)
+	assert.Equal(t, models.NEW_SIDE, lines["New Side Watch"].Side)
+	assert.Equal(t, actions.LineRange{StartLine: 50, EndLine: 51}, lines["New Side Watch"].DiffLines)
+}
+
+func TestDeduplicate(t *testing.T) {
+	first := &actions.Commit{SHA: "aaa", Author: "A <a@example.com>", Subject: "First"}
+	second := &actions.Commit{SHA: "bbb", Author: "B <b@example.com>", Subject: "Second"}
+	lines := &actions.TriggeredLines{WatchedLines: actions.LineRange{StartLine: 20, EndLine: 30}}
+	otherLines := &actions.TriggeredLines{WatchedLines: actions.LineRange{StartLine: 50, EndLine: 50}}
+
+	triggered := []TriggeredWatcher{
+		{Watcher: models.Watcher{Name: "Lines"}, Reason: "Watched lines changed", TriggeredLines: lines, Commit: first},
+		{Watcher: models.Watcher{Name: "Any"}, Reason: "Any Change", Commit: first},
+		{Watcher: models.Watcher{Name: "Lines"}, Reason: "Watched lines changed", TriggeredLines: lines, Commit: second},
+		{Watcher: models.Watcher{Name: "Lines"}, Reason: "Watched lines changed", TriggeredLines: otherLines, Commit: second},
+		{Watcher: models.Watcher{Name: "Any"}, Reason: "Any Change", Commit: second},
+	}
+
+	got := Deduplicate(triggered)
+	require.Len(t, got, 3)
+	assert.Equal(t, first, got[0].Commit)
+	assert.Equal(t, first, got[1].Commit)
+	assert.Equal(t, second, got[2].Commit)
+	assert.Equal(t, otherLines, got[2].TriggeredLines)
+}
+
+func Test_mapLineRange(t *testing.T) {
+	data, err := ioutil.ReadFile("../../../test/multiple.diff")
+	require.Nil(t, err, "Error reading fixture: %s", err)
+	fileDiff, err := diff.ParseFileDiff(data)
+	require.Nil(t, err, "Error parsing fixture: %s", err)
+
+	tests := []struct {
+		name  string
+		lines actions.LineRange
+		want  actions.LineRange
+	}{
+		{
+			name:  "before every hunk",
+			lines: actions.LineRange{StartLine: 20, EndLine: 30},
+			want:  actions.LineRange{StartLine: 20, EndLine: 30},
+		},
+		{
+			name:  "lines inserted inside the range",
+			lines: actions.LineRange{StartLine: 70, EndLine: 80},
+			want:  actions.LineRange{StartLine: 70, EndLine: 86},
+		},
+		{
+			name:  "end of the range replaced",
+			lines: actions.LineRange{StartLine: 90, EndLine: 100},
+			want:  actions.LineRange{StartLine: 99, EndLine: 106},
+		},
+		{
+			name:  "whole range replaced",
+			lines: actions.LineRange{StartLine: 95, EndLine: 97},
+			want:  actions.LineRange{StartLine: 103, EndLine: 106},
+		},
+		{
+			name:  "after every hunk",
+			lines: actions.LineRange{StartLine: 110, EndLine: 120},
+			want:  actions.LineRange{StartLine: 114, EndLine: 124},
+		},
+		{
+			name:  "unbounded",
+			lines: models.FULL_FILE,
+			want:  models.FULL_FILE,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, mapLineRange(fileDiff.Hunks, tt.lines))
+		})
+	}
+}
+
+func TestIndex_AfterDiff(t *testing.T) {
+	index, err := NewIndex(&models.LocalStore{Watchers: []models.Watcher{
+		{Name: "Line Watch", FilePath: "a/test/testdiff.txt", Lines: []actions.LineRange{{StartLine: 20, EndLine: 25}}, Actions: &actions.Actions{}},
+	}})
+	require.Nil(t, err, "Error indexing store: %s", err)
+
+	header := "diff --git a/test/testdiff.txt b/test/testdiff.txt\nindex 1111111..2222222 100644\n--- a/test/testdiff.txt\n+++ b/test/testdiff.txt\n"
+	// The first commit adds 10 lines to the top of the file, and the second changes what was line 22
+	first := header + "@@ -1,3 +1,13 @@\n" + strings.Repeat("+added\n", 10) + " 1\n 2\n 3\n"
+	second := header + "@@ -29,7 +29,7 @@\n 29\n 30\n 31\n-32\n+32 changed\n 33\n 34\n 35\n"
+	evaluate := func(index *Index, diffText string) []string {
+		var watcherNames []string
+		for _, tw := range TriggerWatchers(context.Background(), index, NewDiffReader(strings.NewReader(diffText))).Triggered {
+			watcherNames = append(watcherNames, tw.Watcher.Name)
+		}
+		return watcherNames
+	}
+
+	assert.Empty(t, evaluate(index, first))
+	assert.Empty(t, evaluate(index, second), "the second commit is checked against the ranges from before the first")
+
+	next, err := index.AfterDiff(NewDiffReader(strings.NewReader(first)))
+	require.Nil(t, err, "Error mapping the index: %s", err)
+	assert.Equal(t, []string{"Line Watch"}, evaluate(next, second))
+	assert.Equal(t, []actions.LineRange{{StartLine: 20, EndLine: 25}}, index.all[0].Lines, "the original index shouldn't change")
+}
+
+func TestUpdateLines(t *testing.T) {
+	store, err := models.GetLocalStore("../../../test/.diffhook.yml")
+	require.Nil(t, err, "Error loading store: %s", err)
+
+	f, err := os.Open("../../../test/multiple.diff")
+	require.Nil(t, err, "Error opening file: %s", err)
+	defer f.Close()
+
+	updates, err := UpdateLines(store, NewDiffReader(f))
+	require.Nil(t, err, "Error updating lines: %s", err)
+
+	assert.Equal(t, []LineUpdate{
+		{
+			WatcherName: "Slack Watcher",
+			FilePath:    "a/test/testdiff.txt",
+			Old:         actions.LineRange{StartLine: 70, EndLine: 80},
+			New:         actions.LineRange{StartLine: 70, EndLine: 86},
+		},
+		{
+			WatcherName: "Multiple Line Log Watch",
+			FilePath:    "a/test/testdiff.txt",
+			Old:         actions.LineRange{StartLine: 90, EndLine: 100},
+			New:         actions.LineRange{StartLine: 99, EndLine: 106},
+		},
+	}, updates)
+	assert.Equal(t, actions.LineRange{StartLine: 70, EndLine: 86}, store.Watchers[0].Lines[2])
+}
+
+func Test_locateFingerprint(t *testing.T) {
+	original := []byte("package x\n\nfunc a() {}\n\nfunc watched() {\n\treturn 1\n}\n\nfunc b() {}\n")
+	fingerprint := NewFingerprint(original, actions.LineRange{StartLine: 5, EndLine: 7})
+
+	tests := []struct {
+		name      string
+		content   string
+		want      actions.LineRange
+		wantFound bool
+	}{
+		{
+			name:      "lines haven't moved",
+			content:   string(original),
+			want:      actions.LineRange{StartLine: 5, EndLine: 7},
+			wantFound: true,
+		},
+		{
+			name:      "lines moved down",
+			content:   "package x\n\nimport \"fmt\"\n\nfunc a() {}\n\nfunc watched() {\n\treturn 1\n}\n\nfunc b() {}\n",
+			want:      actions.LineRange{StartLine: 7, EndLine: 9},
+			wantFound: true,
+		},
+		{
+			name:      "lines re-indented and moved",
+			content:   "package x\n\n\nfunc a() {}\n\nfunc   watched() {\n    return 1\n}\n\nfunc b() {}\n",
+			want:      actions.LineRange{StartLine: 6, EndLine: 8},
+			wantFound: true,
+		},
+		{
+			name:      "lines changed a little and moved",
+			content:   "package x\n\n\nfunc a() {}\n\nfunc watched() {\n\treturn 2\n}\n\nfunc b() {}\n",
+			want:      actions.LineRange{StartLine: 6, EndLine: 8},
+			wantFound: true,
+		},
+		{
+			name:      "lines are gone",
+			content:   "package y\n\nfunc c() int {\n\treturn 3\n}\n",
+			want:      actions.LineRange{StartLine: 5, EndLine: 7},
+			wantFound: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, found := locateFingerprint(&fingerprint, []byte(tt.content))
+			assert.Equal(t, tt.wantFound, found)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestGitSource(t *testing.T) {
+	// The repository isn't the working directory, so the files can only be found relative to the source's directory
+	dir := t.TempDir()
+	gitCmd := exec.Command("git", "init", "-q", dir)
+	out, err := gitCmd.CombinedOutput()
+	require.Nil(t, err, "Error running git init: %s", out)
+
+	filePath := filepath.Join(dir, "test", "testdiff.txt")
+	require.Nil(t, os.MkdirAll(filepath.Dir(filePath), 0755))
+	require.Nil(t, ioutil.WriteFile(filePath, []byte("committed\n"), 0644))
+	gitCmd = exec.Command("git", "-C", dir, "hash-object", "-w", filePath)
+	out, err = gitCmd.CombinedOutput()
+	require.Nil(t, err, "Error running git hash-object: %s", out)
+	blob := strings.TrimSpace(string(out))
+	// The new side is only in the working tree, like in a diff of uncommitted changes
+	require.Nil(t, ioutil.WriteFile(filePath, []byte("uncommitted\n"), 0644))
+
+	fileDiff := &diff.FileDiff{
+		OrigName: "a/test/testdiff.txt",
+		NewName:  "b/test/testdiff.txt",
+		Extended: []string{"diff --git a/test/testdiff.txt b/test/testdiff.txt", "index " + blob[:7] + "..1234567 100644"},
+	}
+	source := GitSource{Dir: dir}
+
+	old, err := source.Old(fileDiff)
+	require.Nil(t, err, "Error reading the old file: %s", err)
+	assert.Equal(t, "committed\n", string(old))
+
+	newContent, err := source.New(fileDiff)
+	require.Nil(t, err, "Error reading the new file: %s", err)
+	assert.Equal(t, "uncommitted\n", string(newContent))
+}
+
+type stubSource struct {
+	old, new []byte
+}
+
+func (s stubSource) Old(*diff.FileDiff) ([]byte, error) {
+	return s.old, nil
+}
+
+func (s stubSource) New(*diff.FileDiff) ([]byte, error) {
+	return s.new, nil
+}
+
+func TestTriggerWatchersRelocatesFingerprintedLines(t *testing.T) {
+	var content bytes.Buffer
+	for i := 1; i <= 60; i++ {
+		fmt.Fprintf(&content, "line %d\n", i)
+	}
+	// The ranges are stale, but the fingerprint was taken when line 22 was at 40
+	var fingerprintedContent bytes.Buffer
+	for i := 1; i <= 60; i++ {
+		fmt.Fprintf(&fingerprintedContent, "line %d\n", i-18)
+	}
+	stale := actions.LineRange{StartLine: 40, EndLine: 40}
+	index, err := NewIndex(&models.LocalStore{Watchers: []models.Watcher{
+		{
+			Name:         "Fingerprinted Watch",
+			FilePath:     "a/test/testdiff.txt",
+			Lines:        []actions.LineRange{stale},
+			Fingerprints: []models.Fingerprint{NewFingerprint(fingerprintedContent.Bytes(), stale)},
+			Actions:      &actions.Actions{},
+		},
+		{
+			Name:     "Stale Watch",
+			FilePath: "a/test/testdiff.txt",
+			Lines:    []actions.LineRange{stale},
+			Actions:  &actions.Actions{},
+		},
+	}})
+	require.Nil(t, err, "Error indexing store: %s", err)
+	index = index.WithSource(stubSource{old: content.Bytes()})
+
+	f, err := os.Open("../../../test/one_line.diff")
+	require.Nil(t, err, "Error opening file: %s", err)
+	defer f.Close()
+
+	triggered := TriggerWatchers(context.Background(), index, NewDiffReader(f)).Triggered
+	require.Len(t, triggered, 1)
+	assert.Equal(t, "Fingerprinted Watch", triggered[0].Watcher.Name)
+	assert.Equal(t, actions.LineRange{StartLine: 22, EndLine: 22}, triggered[0].TriggeredLines.WatchedLines)
+}
+
+func TestTriggerWatchersFingerprintedOverlap(t *testing.T) {
+	var content bytes.Buffer
+	for i := 1; i <= 60; i++ {
+		fmt.Fprintf(&content, "line %d\n", i)
+	}
+	lines := actions.LineRange{StartLine: 23, EndLine: 23}
+	index, err := NewIndex(&models.LocalStore{Watchers: []models.Watcher{
+		{Name: "Indexed Watch", FilePath: "a/test/testdiff.txt", Lines: []actions.LineRange{lines}},
+		{
+			Name:         "Fingerprinted Watch",
+			FilePath:     "a/test/testdiff.txt",
+			Lines:        []actions.LineRange{lines},
+			Fingerprints: []models.Fingerprint{NewFingerprint(content.Bytes(), lines)},
+		},
+	}})
+	require.Nil(t, err, "Error indexing store: %s", err)
+
+	// Without any context lines the changed range comes out inverted, which both kinds of watcher have to handle the
+	// same way
+	diffText := `diff --git a/test/testdiff.txt b/test/testdiff.txt
+index 3c53ee9..7b3c89b 100644
+--- a/test/testdiff.txt
++++ b/test/testdiff.txt
+@@ -20 +20 @@
+-line 20
++line twenty
+`
+	result := TriggerWatchers(context.Background(), index.WithSource(stubSource{old: content.Bytes()}), NewDiffReader(strings.NewReader(diffText)))
+	var watcherNames []string
+	for _, tw := range result.Triggered {
+		watcherNames = append(watcherNames, tw.Watcher.Name)
+	}
+	assert.ElementsMatch(t, []string{"Indexed Watch", "Fingerprinted Watch"}, watcherNames)
+}
+
+func Test_relocateLinesFullFile(t *testing.T) {
+	var content bytes.Buffer
+	for i := 1; i <= 60; i++ {
+		fmt.Fprintf(&content, "line %d\n", i)
+	}
+	// Older versions of diffhook fingerprint also fingerprinted whole file ranges
+	watcher := models.Watcher{
+		Name:         "Whole File Watch",
+		FilePath:     "a/test/testdiff.txt",
+		Lines:        []actions.LineRange{models.FULL_FILE},
+		Fingerprints: []models.Fingerprint{NewFingerprint(content.Bytes(), models.FULL_FILE)},
+	}
+
+	relocated, err := relocateLines(stubSource{old: content.Bytes()}, watcher, &diff.FileDiff{OrigName: watcher.FilePath})
+	require.Nil(t, err, "Error relocating lines: %s", err)
+	assert.Equal(t, []actions.LineRange{models.FULL_FILE}, relocated)
+}
+
+func Test_relocateLinesCopies(t *testing.T) {
+	lines := []actions.LineRange{{StartLine: 50, EndLine: 51}, {StartLine: 20, EndLine: 22}}
+	watcher := models.Watcher{
+		Name:         "Fingerprinted Watch",
+		FilePath:     "a/test/testdiff.txt",
+		Lines:        lines,
+		Fingerprints: []models.Fingerprint{{Lines: lines[1], Hash: "stale"}},
+	}
+
+	// The watcher's lines are shared with the index, so changing the relocated lines mustn't change them, even when
+	// the file can't be read and nothing is relocated
+	for name, source := range map[string]Source{"readable": stubSource{}, "unreadable": errSource{}} {
+		t.Run(name, func(t *testing.T) {
+			relocated, _ := relocateLines(source, watcher, &diff.FileDiff{OrigName: watcher.FilePath})
+			require.Equal(t, lines, relocated)
+			relocated[0] = models.FULL_FILE
+			assert.Equal(t, actions.LineRange{StartLine: 50, EndLine: 51}, watcher.Lines[0])
+		})
+	}
+}
+
+func TestTriggerWatchersIgnoreFormatting(t *testing.T) {
+	oldContent, err := ioutil.ReadFile("../../../test/formatting/old.go.txt")
+	require.Nil(t, err, "Error reading file: %s", err)
+
+	greeting := []actions.LineRange{{StartLine: 3, EndLine: 15}}
+	index, err := NewIndex(&models.LocalStore{Watchers: []models.Watcher{
+		{Name: "Formatting Watch", FilePath: "a/handler/handler.go", Lines: greeting, IgnoreFormatting: true, Actions: &actions.Actions{}},
+		{Name: "Plain Watch", FilePath: "a/handler/handler.go", Lines: greeting, Actions: &actions.Actions{}},
+		{
+			Name:             "New Side Formatting Watch",
+			FilePath:         "a/handler/handler.go",
+			LineSide:         models.NEW_SIDE,
+			Lines:            []actions.LineRange{{StartLine: 1, EndLine: 20}},
+			IgnoreFormatting: true,
+			Actions:          &actions.Actions{},
+		},
+	}})
+	require.Nil(t, err, "Error indexing store: %s", err)
+
+	tests := []struct {
+		name string
+		// oldContent defaults to old.go.txt
+		oldContent       string
+		newContent       string
+		fixture          string
+		wantWatcherNames []string
+	}{
+		{
+			name:             "reformatted with reordered imports and new comments",
+			newContent:       "../../../test/formatting/formatted.go.txt",
+			fixture:          "../../../test/formatting/formatted.diff",
+			wantWatcherNames: []string{"Plain Watch"},
+		},
+		{
+			name:             "string literal changed",
+			newContent:       "../../../test/formatting/changed.go.txt",
+			fixture:          "../../../test/formatting/changed.diff",
+			wantWatcherNames: []string{"Formatting Watch", "Plain Watch", "New Side Formatting Watch"},
+		},
+		{
+			name:             "type alias changed to a defined type",
+			oldContent:       "../../../test/formatting/semantic_old.go.txt",
+			newContent:       "../../../test/formatting/alias.go.txt",
+			fixture:          "../../../test/formatting/alias.diff",
+			wantWatcherNames: []string{"Formatting Watch", "Plain Watch", "New Side Formatting Watch"},
+		},
+		{
+			name:             "variadic call changed to a plain call",
+			oldContent:       "../../../test/formatting/semantic_old.go.txt",
+			newContent:       "../../../test/formatting/variadic.go.txt",
+			fixture:          "../../../test/formatting/variadic.diff",
+			wantWatcherNames: []string{"Formatting Watch", "Plain Watch", "New Side Formatting Watch"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			old := oldContent
+			if tt.oldContent != "" {
+				var err error
+				old, err = ioutil.ReadFile(tt.oldContent)
+				require.Nil(t, err, "Error reading file: %s", err)
 			}
+			newContent, err := ioutil.ReadFile(tt.newContent)
+			require.Nil(t, err, "Error reading file: %s", err)
+			f, err := os.Open(tt.fixture)
+			require.Nil(t, err, "Error opening file: %s", err)
 			defer f.Close()
-			mr := diff.NewMultiFileDiffReader(f)
-			watchers := TriggerWatchers(mr)
+
 			var watcherNames []string
-			for _, w := range watchers {
-				watcherNames = append(watcherNames, w.Watcher.Name)
+			for _, tw := range TriggerWatchers(context.Background(), index.WithSource(stubSource{old: old, new: newContent}), NewDiffReader(f)).Triggered {
+				watcherNames = append(watcherNames, tw.Watcher.Name)
 			}
-
 			assert.ElementsMatch(t, tt.wantWatcherNames, watcherNames)
 		})
 	}
 }
 
+func TestFollowRenames(t *testing.T) {
+	tests := []struct {
+		name        string
+		fixture     string
+		wantNewPath string
+	}{
+		{name: "file renamed", fixture: "../../../test/rename.diff", wantNewPath: "a/test/testdiff2.txt"},
+		{name: "file moved", fixture: "../../../test/move.diff", wantNewPath: "a/test/othertest/testdiff.txt"},
+		{name: "renamed with lines changed", fixture: "../../../test/multiple_and_rename.diff", wantNewPath: "a/test/testdiff2.txt"},
+		{name: "lines changed", fixture: "../../../test/one_line.diff", wantNewPath: ""},
+		{name: "file deleted", fixture: "../../../test/delete.diff", wantNewPath: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store, err := models.GetLocalStore("../../../test/.diffhook.yml")
+			require.Nil(t, err, "Error loading store: %s", err)
+
+			f, err := os.Open(tt.fixture)
+			require.Nil(t, err, "Error opening file: %s", err)
+			defer f.Close()
+
+			updates, err := FollowRenames(store, NewDiffReader(f))
+			require.Nil(t, err, "Error following renames: %s", err)
+
+			if tt.wantNewPath == "" {
+				assert.Empty(t, updates)
+				return
+			}
+			assert.Len(t, updates, len(store.Watchers))
+			for _, w := range store.Watchers {
+				assert.Equal(t, tt.wantNewPath, w.FilePath)
+			}
+		})
+	}
+}
+
+func Test_parseSubmoduleChange(t *testing.T) {
+	tests := []struct {
+		name    string
+		fixture string
+		want    *actions.SubmoduleChange
+	}{
+		{
+			name:    "submodule bumped",
+			fixture: "../../../test/submodule.diff",
+			want: &actions.SubmoduleChange{
+				Path:      "vendor/lib",
+				OldCommit: "1f3c2a1d7e1c5b0a8f1e2d3c4b5a69788796a5b4",
+				NewCommit: "9b8e7d6c5b4a39281706f5e4d3c2b1a098877665",
+			},
+		},
+		{
+			name:    "regular file changed",
+			fixture: "../../../test/one_line.diff",
+			want:    nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := ioutil.ReadFile(tt.fixture)
+			require.Nil(t, err, "Error reading fixture: %s", err)
+			fileDiff, err := diff.ParseFileDiff(data)
+			require.Nil(t, err, "Error parsing fixture: %s", err)
+
+			assert.Equal(t, tt.want, parseSubmoduleChange(fileDiff))
+		})
+	}
+}
+
+func TestTriggerWatchersSubmoduleHistory(t *testing.T) {
+	dir := t.TempDir()
+	lib := filepath.Join(dir, "vendor", "lib")
+	require.Nil(t, os.MkdirAll(lib, 0755))
+	git := func(args ...string) string {
+		gitCmd := exec.Command("git", append([]string{"-C", lib, "-c", "user.name=Test", "-c", "user.email=test@example.com"}, args...)...)
+		out, err := gitCmd.CombinedOutput()
+		require.Nil(t, err, "Error running git %v: %s", args, out)
+		return strings.TrimSpace(string(out))
+	}
+	git("init", "-q")
+	git("commit", "-q", "--allow-empty", "-m", "Initial")
+	oldCommit := git("rev-parse", "HEAD")
+	git("commit", "-q", "--allow-empty", "-m", "Bump the thing")
+	newCommit := git("rev-parse", "HEAD")
+
+	// The store is outside of the working directory, so the submodule can only be found relative to the store
+	storeFile := filepath.Join(dir, ".diffhook.yml")
+	watchers := "watchers:\n  - name: Submodule Watch\n    file_path: a/vendor/lib\n    trigger_on_submodule: true\n"
+	require.Nil(t, ioutil.WriteFile(storeFile, []byte(watchers), 0644))
+	store, err := models.GetLocalStore(storeFile)
+	require.Nil(t, err, "Error loading store: %s", err)
+	index, err := NewIndex(store)
+	require.Nil(t, err, "Error indexing store: %s", err)
+
+	diffText := fmt.Sprintf(`diff --git a/vendor/lib b/vendor/lib
+index %s..%s 160000
+--- a/vendor/lib
++++ b/vendor/lib
+@@ -1 +1 @@
+-Subproject commit %s
++Subproject commit %s
+`, oldCommit[:7], newCommit[:7], oldCommit, newCommit)
+	result := TriggerWatchers(context.Background(), index, NewDiffReader(strings.NewReader(diffText)))
+	require.Len(t, result.Triggered, 1)
+
+	submodule := result.Triggered[0].Submodule
+	require.NotNil(t, submodule)
+	assert.True(t, submodule.CheckedOut)
+	assert.Equal(t, 1, submodule.Commits)
+	require.Len(t, submodule.Log, 1)
+	assert.Contains(t, submodule.Log[0], "Bump the thing")
+}
+
+func Test_parseAssetChange(t *testing.T) {
+	tests := []struct {
+		name    string
+		fixture string
+		want    *actions.AssetChange
+	}{
+		{
+			name:    "lfs pointer changed",
+			fixture: "../../../test/lfs.diff",
+			want: &actions.AssetChange{
+				Path:    "assets/logo.png",
+				OldOid:  "sha256:4d7a214614ab2935c943f9e0ff69d22eadbb8f32b1258daaa5e2ca24d17e2393",
+				NewOid:  "sha256:2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae",
+				OldSize: 1000,
+				NewSize: 1300,
+			},
+		},
+		{
+			name:    "lfs pointer changed without the sizes",
+			fixture: "../../../test/lfs_oid_only.diff",
+			want: &actions.AssetChange{
+				Path:   "assets/logo.png",
+				OldOid: "sha256:4d7a214614ab2935c943f9e0ff69d22eadbb8f32b1258daaa5e2ca24d17e2393",
+				NewOid: "sha256:2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae",
+			},
+		},
+		{
+			name:    "regular file changed",
+			fixture: "../../../test/one_line.diff",
+			want:    nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := ioutil.ReadFile(tt.fixture)
+			require.Nil(t, err, "Error reading fixture: %s", err)
+			fileDiff, err := diff.ParseFileDiff(data)
+			require.Nil(t, err, "Error parsing fixture: %s", err)
+
+			assert.Equal(t, tt.want, parseAssetChange(fileDiff))
+		})
+	}
+}
+
 func equalTriggeredLines(x, y *actions.TriggeredLines) bool {
 	if x == nil && y == nil {
 		return true
@@ -526,4 +2099,73 @@ func makeMockFileDiff(diffLines []actions.LineRange) *diff.FileDiff {
 	return &diff.FileDiff{
 		Hunks: make([]*diff.Hunk, len(diffLines)),
 	}
-}
\ No newline at end of file
+}
+func Test_exclusionsAttribute(t *testing.T) {
+	e := &exclusions{gitattributes: parseGitattributes([]byte(`# comment
+*.pb.go linguist-generated
+vendor/** linguist-vendored
+vendor/ours/** -linguist-vendored
+/docs/notes.txt diffhook-ignore=true
+docs/*.txt !diffhook-ignore
+`))}
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"api.pb.go", "linguist-generated"},
+		{"internal/api/api.pb.go", "linguist-generated"},
+		{"vendor/lib/lib.go", "linguist-vendored"},
+		{"vendor/ours/lib.go", ""},
+		{"docs/notes.txt", ""},
+		{"src/main.go", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			assert.Equal(t, tt.want, e.attribute(tt.path))
+		})
+	}
+}
+
+// Builds a store of watchers spread over files, and a diff that changes a few lines in each of those files
+func benchmarkFixtures(b *testing.B, files, watchersPerFile int) (*Index, []byte) {
+	var watchers []models.Watcher
+	var diffText bytes.Buffer
+	for f := 0; f < files; f++ {
+		filePath := fmt.Sprintf("a/src/file%d.go", f)
+		for w := 0; w < watchersPerFile; w++ {
+			start := 1 + w*10
+			watchers = append(watchers, models.Watcher{
+				Name:     fmt.Sprintf("Watcher %d-%d", f, w),
+				FilePath: filePath,
+				Lines:    []actions.LineRange{{StartLine: start + 5, EndLine: start + 8}, {StartLine: start, EndLine: start + 2}},
+				Actions:  &actions.Actions{},
+			})
+		}
+
+		fmt.Fprintf(&diffText, "diff --git %s b/src/file%d.go\nindex 1111111..2222222 100644\n--- %s\n+++ b/src/file%d.go\n", filePath, f, filePath, f)
+		for h := 0; h < 5; h++ {
+			start := 1 + h*watchersPerFile*2
+			fmt.Fprintf(&diffText, "@@ -%d,7 +%d,7 @@\n line\n line\n line\n-old\n+new\n line\n line\n line\n", start, start)
+		}
+	}
+
+	index, err := NewIndex(&models.LocalStore{Watchers: watchers})
+	require.Nil(b, err, "Error indexing store: %s", err)
+	return index, diffText.Bytes()
+}
+
+func benchmarkTriggerWatchers(b *testing.B, files, watchersPerFile int) {
+	index, diffText := benchmarkFixtures(b, files, watchersPerFile)
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		TriggerWatchers(context.Background(), index, NewDiffReader(bytes.NewReader(diffText)))
+	}
+}
+
+func BenchmarkTriggerWatchers100Files10Watchers(b *testing.B)  { benchmarkTriggerWatchers(b, 100, 10) }
+func BenchmarkTriggerWatchers100Files100Watchers(b *testing.B) { benchmarkTriggerWatchers(b, 100, 100) }
+func BenchmarkTriggerWatchers1000Files10Watchers(b *testing.B) { benchmarkTriggerWatchers(b, 1000, 10) }
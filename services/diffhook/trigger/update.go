@@ -0,0 +1,268 @@
+package trigger
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/bennettaur/diffhook/services/diffhook/models"
+	"github.com/bennettaur/diffhook/services/diffhook/models/actions"
+	"github.com/sourcegraph/go-diff/diff"
+)
+
+// LineUpdate records a watched line range that's in a different place after the diff is applied
+type LineUpdate struct {
+	WatcherName string
+	FilePath    string
+	Old         actions.LineRange
+	New         actions.LineRange
+}
+
+func (u LineUpdate) String() string {
+	return fmt.Sprintf("%s (%s): %s -> %s", u.WatcherName, u.FilePath, u.Old, u.New)
+}
+
+// UpdateLines maps the line ranges of every watcher in the store from the old side of the diff to the new side,
+// updating the store's watchers in place. Deleted files are left alone, merges are mapped through their first parent
+// only, and watchers whose lines are already on the new side are skipped.
+func UpdateLines(store *models.LocalStore, diffReader FileDiffReader) ([]LineUpdate, error) {
+	var updates []LineUpdate
+	for {
+		fileDiff, err := diffReader.ReadFile()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return updates, err
+		}
+
+		if deleted(fileDiff) || len(fileDiff.Hunks) == 0 {
+			continue
+		}
+		if mr, ok := diffReader.(mergeParentReader); ok {
+			if mergeParent := mr.MergeParent(fileDiff); mergeParent != nil && mergeParent.Parent > 1 {
+				continue
+			}
+		}
+		updates = append(updates, updateFileLines(store.Watchers, fileDiff)...)
+	}
+	return updates, nil
+}
+
+// Maps the line ranges of the file's watchers through the file's diff, updating the watchers in place
+func updateFileLines(watchers []models.Watcher, fileDiff *diff.FileDiff) []LineUpdate {
+	var updates []LineUpdate
+	for i := range watchers {
+		watcher := &watchers[i]
+		if watcher.FilePath != fileDiff.OrigName || watcher.Side() == models.NEW_SIDE {
+			continue
+		}
+
+		for j, lines := range watcher.Lines {
+			newLines := mapLineRange(fileDiff.Hunks, lines)
+			if newLines == lines {
+				continue
+			}
+			updates = append(updates, LineUpdate{
+				WatcherName: watcher.Name,
+				FilePath:    watcher.FilePath,
+				Old:         lines,
+				New:         newLines,
+			})
+			if fingerprint := watcher.FingerprintFor(lines); fingerprint != nil {
+				fingerprint.Lines = newLines
+			}
+			watcher.Lines[j] = newLines
+		}
+	}
+	return updates
+}
+
+// PathUpdate records a watcher being pointed at the new location of a renamed or moved file
+type PathUpdate struct {
+	WatcherName string
+	Old         string
+	New         string
+}
+
+func (u PathUpdate) String() string {
+	return fmt.Sprintf("%s: %s -> %s", u.WatcherName, u.Old, u.New)
+}
+
+// FollowRenames points every watcher of a file that was renamed or moved in the diff at the file's new path, updating
+// the store's watchers in place
+func FollowRenames(store *models.LocalStore, diffReader FileDiffReader) ([]PathUpdate, error) {
+	var updates []PathUpdate
+	for {
+		fileDiff, err := diffReader.ReadFile()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return updates, err
+		}
+
+		updates = append(updates, followRename(store.Watchers, fileDiff)...)
+	}
+	return updates, nil
+}
+
+// Points the watchers of the file at its new path if the diff renamed or moved it, updating the watchers in place
+func followRename(watchers []models.Watcher, fileDiff *diff.FileDiff) []PathUpdate {
+	if deleted(fileDiff) || fileDiff.OrigName == "/dev/null" {
+		return nil
+	}
+	newPath := "a/" + trimDiffPrefix(fileDiff.NewName)
+	if newPath == fileDiff.OrigName {
+		return nil
+	}
+
+	var updates []PathUpdate
+	for i := range watchers {
+		watcher := &watchers[i]
+		if watcher.FilePath != fileDiff.OrigName {
+			continue
+		}
+		updates = append(updates, PathUpdate{WatcherName: watcher.Name, Old: watcher.FilePath, New: newPath})
+		watcher.FilePath = newPath
+	}
+	return updates
+}
+
+// AfterDiff returns a copy of the index with its watchers' line ranges and paths moved to where they are once the diff
+// has been applied, so the next diff in a sequence, like the next commit in a range, is evaluated against ranges that
+// are still accurate. Watchers whose lines are on the new side are left as they are, and merges are skipped since the
+// commits they bring in are mapped through on their own.
+func (index *Index) AfterDiff(diffReader FileDiffReader) (*Index, error) {
+	watchers := make([]models.Watcher, len(index.all))
+	for i, watcher := range index.all {
+		watcher.Lines = append([]actions.LineRange(nil), watcher.Lines...)
+		watcher.Fingerprints = append([]models.Fingerprint(nil), watcher.Fingerprints...)
+		watchers[i] = watcher
+	}
+
+	for {
+		fileDiff, err := diffReader.ReadFile()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if mr, ok := diffReader.(mergeParentReader); ok && mr.MergeParent(fileDiff) != nil {
+			continue
+		}
+
+		if !deleted(fileDiff) && len(fileDiff.Hunks) > 0 {
+			updateFileLines(watchers, fileDiff)
+		}
+		followRename(watchers, fileDiff)
+	}
+
+	return &Index{
+		all:      watchers,
+		watchers: models.NewIndex(watchers),
+		exclude:  index.exclude,
+		freezes:  index.freezes,
+		dir:      index.dir,
+		source:   index.source,
+	}, nil
+}
+
+// Maps a range on the old side of the diff to the new side. If the lines at either end of the range were removed,
+// the range shrinks to the closest lines that are still there.
+func mapLineRange(hunks []*diff.Hunk, lines actions.LineRange) actions.LineRange {
+	if lines.StartLine < 0 || lines.EndLine < 0 {
+		// Unbounded ranges cover the whole file wherever it is
+		return lines
+	}
+
+	mapped := actions.LineRange{
+		StartLine: mapLine(hunks, lines.StartLine, false),
+		EndLine:   mapLine(hunks, lines.EndLine, true),
+	}
+	if mapped.EndLine < mapped.StartLine {
+		// Every line in the range was removed, so keep watching where they used to be
+		mapped.EndLine = mapped.StartLine
+	}
+	return mapped
+}
+
+// Maps an old line number to its new line number. Removed lines map to the first line that replaced them (or the
+// next line that's still there), or the last line that replaced them (or the previous line) if preferPrevious is set.
+func mapLine(hunks []*diff.Hunk, line int, preferPrevious bool) int {
+	offset := 0
+	for _, hunk := range hunks {
+		origStart := int(hunk.OrigStartLine)
+		origLines := int(hunk.OrigLines)
+
+		if origLines == 0 {
+			// Pure insertions come after OrigStartLine
+			if line <= origStart {
+				break
+			}
+			offset += int(hunk.NewLines)
+			continue
+		}
+
+		if line < origStart {
+			break
+		}
+		if line >= origStart+origLines {
+			offset += int(hunk.NewLines) - origLines
+			continue
+		}
+		return mapLineInHunk(hunk, line, preferPrevious)
+	}
+	return line + offset
+}
+
+func mapLineInHunk(hunk *diff.Hunk, line int, preferPrevious bool) int {
+	origLine := int(hunk.OrigStartLine)
+	newLine := int(hunk.NewStartLine)
+
+	scanner := bufio.NewScanner(bytes.NewReader(hunk.Body))
+	for scanner.Scan() {
+		text := scanner.Text()
+		if len(text) == 0 {
+			text = " "
+		}
+
+		switch text[0] {
+		case '+':
+			newLine++
+		case '-':
+			if origLine == line {
+				if preferPrevious {
+					return newLine + countReplacementLines(scanner) - 1
+				}
+				return newLine
+			}
+			origLine++
+		case '\\':
+		default:
+			if origLine == line {
+				return newLine
+			}
+			origLine++
+			newLine++
+		}
+	}
+	return newLine
+}
+
+// Counts the lines added in the rest of the current block of changes
+func countReplacementLines(scanner *bufio.Scanner) int {
+	added := 0
+	for scanner.Scan() {
+		text := scanner.Text()
+		if len(text) == 0 || text[0] == ' ' {
+			break
+		}
+		if text[0] == '+' {
+			added++
+		}
+	}
+	return added
+}